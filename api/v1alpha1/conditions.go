@@ -0,0 +1,49 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of QWorkers and ScalerConfigs
+const (
+	// BrokerReachableCondition reports whether the broker answers, for a ScalerConfig its connection
+	// check and for a QWorker the queue length query.
+	BrokerReachableCondition = "BrokerReachable"
+	// ScalerConfigResolvedCondition reports whether the ScalerConfig of a QWorker was found and its broker created.
+	ScalerConfigResolvedCondition = "ScalerConfigResolved"
+	// ScalingActiveCondition reports whether the desired replicas of a QWorker are computed from its queue.
+	ScalingActiveCondition = "ScalingActive"
+	// ScalingLimitedCondition reports whether the desired replicas of a QWorker were capped by its
+	// minReplicas, its maxReplicas or the number of consumers its queue supports.
+	ScalingLimitedCondition = "ScalingLimited"
+	// PodCreationFailedCondition reports whether the controller failed to create a worker pod of a QWorker.
+	PodCreationFailedCondition = "PodCreationFailed"
+	// ManualOverrideCondition reports whether the desired replicas of a QWorker are pinned by spec.replicas.
+	ManualOverrideCondition = "ManualOverride"
+	// FallbackCondition reports whether the desired replicas of a QWorker are set by its fallback because its
+	// queue could not be polled.
+	FallbackCondition = "Fallback"
+)
+
+// SetCondition sets a condition of the QWorker, as observed at its current generation
+func (q *QWorker) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&q.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: q.Generation,
+	})
+}
+
+// SetCondition sets a condition of the ScalerConfig, as observed at its current generation
+func (sc *ScalerConfig) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&sc.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: sc.Generation,
+	})
+}
@@ -17,35 +17,218 @@ limitations under the License.
 package v1alpha1
 
 import (
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// DrainDeadlineAnnotation is set by the controller on worker pods selected for
+	// scale-down. Its value is the RFC3339 time after which the pod is deleted.
+	DrainDeadlineAnnotation = "quickube.com/drain-deadline"
+	// DrainAcknowledgedAnnotation is set to "true" by a draining worker once it has
+	// finished its in-flight work and can be deleted.
+	DrainAcknowledgedAnnotation = "quickube.com/drain-acknowledged"
+	// PodSpecHashAnnotation records the hash of the QWorker pod spec a worker pod was created from.
+	PodSpecHashAnnotation = "quickube.com/pod-spec-hash"
+	// QWorkerLabel is set on worker pods to the name of their QWorker. It is the selector of the scale subresource.
+	QWorkerLabel = "quickube.com/qworker"
 )
 
 type QWorkerSpec struct {
 	PodSpec     corev1.PodSpec     `json:"podSpec"`
 	ScaleConfig QWorkerScaleConfig `json:"scaleConfig,omitempty"`
+	// +optional
+	RolloutStrategy QWorkerRolloutStrategy `json:"rolloutStrategy,omitempty"`
+	// Replicas pins the desired replicas by hand, e.g. with kubectl scale, instead of
+	// computing them from the queue. The override is removed once ManualReplicasTTLSeconds pass.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replicas *int `json:"replicas,omitempty"`
+	// ManualReplicasTTLSeconds is how long Replicas pins the desired replicas after it was
+	// last set. The override does not expire when it is not set.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ManualReplicasTTLSeconds *int `json:"manualReplicasTTLSeconds,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=RollingUpdate;OnDelete
+type QWorkerRolloutStrategyType string
+
+const (
+	// RollingUpdateRolloutStrategyType drains outdated workers and replaces them with workers running the current pod spec.
+	RollingUpdateRolloutStrategyType QWorkerRolloutStrategyType = "RollingUpdate"
+	// OnDeleteRolloutStrategyType leaves outdated workers running until they terminate themselves.
+	OnDeleteRolloutStrategyType QWorkerRolloutStrategyType = "OnDelete"
+)
+
+type QWorkerRolloutStrategy struct {
+	// +kubebuilder:default=RollingUpdate
+	// +optional
+	Type QWorkerRolloutStrategyType `json:"type,omitempty"`
+	// MaxSurge is the number or percentage of desired replicas that can be created
+	// above the desired amount while outdated workers are replaced. Defaults to 25%.
+	// +optional
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+	// MaxUnavailable is the number or percentage of desired replicas that can be
+	// unavailable while outdated workers are drained. Defaults to 25%.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
 }
 
 type QWorkerStatus struct {
 	CurrentReplicas    int    `json:"currentReplicas"`
 	DesiredReplicas    int    `json:"desiredReplicas"`
+	DrainingReplicas   int    `json:"drainingReplicas"`
+	UpdatedReplicas    int    `json:"updatedReplicas"`
+	OutdatedReplicas   int    `json:"outdatedReplicas"`
 	CurrentPodSpecHash string `json:"currentPodSpecHash"`
+	QueueLength        int    `json:"queueLength"`
+	// EnqueueRate is the estimated number of messages per second added to the queue.
+	// +optional
+	EnqueueRate *resource.Quantity `json:"enqueueRate,omitempty"`
+	// DrainRate is the estimated number of messages per second consumed from the queue.
+	// +optional
+	DrainRate *resource.Quantity `json:"drainRate,omitempty"`
+	// Active is true while a QWorker that scales to zero is scaled up. QWorkers with
+	// a positive minReplicas are always active.
+	Active bool `json:"active"`
+	// LastActiveTime is the last time the queue had messages.
+	// +optional
+	LastActiveTime *metav1.Time `json:"lastActiveTime,omitempty"`
+	// Recommendations are the desired replicas computed from the queue within the
+	// stabilization windows of the scaling behavior, oldest first. Each recommendation
+	// holds until the next one.
+	// +optional
+	Recommendations []ReplicaRecommendation `json:"recommendations,omitempty"`
+	// ScaleEvents are the changes of the desired replicas within the longest period of
+	// the scaling policies, oldest first.
+	// +optional
+	ScaleEvents []ScaleEvent `json:"scaleEvents,omitempty"`
 	// +kubebuilder:default={}
 	MaxContainerResourcesUsage []corev1.ResourceList `json:"maxContainerResourcesUsage"`
+	// ManualReplicas is the value of spec.replicas the desired replicas are pinned to.
+	// +optional
+	ManualReplicas *int `json:"manualReplicas,omitempty"`
+	// ManualReplicasTime is when the desired replicas were pinned to ManualReplicas.
+	// +optional
+	ManualReplicasTime *metav1.Time `json:"manualReplicasTime,omitempty"`
+	// ConsecutiveFailures is the number of polls in a row that failed to compute the desired
+	// replicas from the queue.
+	// +optional
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+	// Selector is the label selector of the worker pods, for the scale subresource.
+	// +optional
+	Selector string `json:"selector,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+type ReplicaRecommendation struct {
+	Timestamp metav1.Time `json:"timestamp"`
+	Replicas  int         `json:"replicas"`
+}
+
+type ScaleEvent struct {
+	Timestamp metav1.Time `json:"timestamp"`
+	// Change is the number of desired replicas added, or removed when negative.
+	Change int `json:"change"`
 }
 
+// +kubebuilder:validation:Enum=QueueLength;Rate
+type ScalingMode string
+
+const (
+	// QueueLengthScalingMode sizes the fleet from the current queue length.
+	QueueLengthScalingMode ScalingMode = "QueueLength"
+	// RateScalingMode sizes the fleet from the enqueue rate and the throughput of a single worker.
+	RateScalingMode ScalingMode = "Rate"
+)
+
 type QWorkerScaleConfig struct {
 	ScalerConfigRef string `json:"scalerConfigRef"`
 	Queue           string `json:"queue"`
 	MinReplicas     int    `json:"minReplicas"`
 	MaxReplicas     int    `json:"maxReplicas"`
-	ScalingFactor   int    `json:"scalingFactor"`
+	// ScalingFactor is the number of replicas per message in the queue, in the QueueLength
+	// scaling mode, 1 when it is not set. It is ignored when TargetQueueLengthPerReplica is set.
+	// +kubebuilder:default=1
+	// +optional
+	ScalingFactor *int `json:"scalingFactor,omitempty"`
+	// TargetQueueLengthPerReplica is the number of messages in the queue per replica in the
+	// QueueLength scaling mode, e.g. "50" for one replica per 50 messages. Desired replicas
+	// are rounded up.
+	// +optional
+	TargetQueueLengthPerReplica *resource.Quantity `json:"targetQueueLengthPerReplica,omitempty"`
 	// +kubebuilder:default=false
 	ActivateVPA bool `json:"activateVPA"`
+	// ScaleDownGracePeriodSeconds is how long a worker selected for scale-down is
+	// given to acknowledge the drain before the controller deletes it.
+	// +kubebuilder:default=300
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ScaleDownGracePeriodSeconds int `json:"scaleDownGracePeriodSeconds"`
+	// +kubebuilder:default=QueueLength
+	// +optional
+	ScalingMode ScalingMode `json:"scalingMode,omitempty"`
+	// ThroughputPerReplica is the number of messages per second a single worker processes.
+	// It is required by the Rate scaling mode.
+	// +optional
+	ThroughputPerReplica *resource.Quantity `json:"throughputPerReplica,omitempty"`
+	// RateWindowSeconds is the period over which queue rates are measured. In the Rate
+	// scaling mode, it is also the time the fleet is sized to clear the current backlog in.
+	// +kubebuilder:default=60
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RateWindowSeconds int `json:"rateWindowSeconds,omitempty"`
+	// ActivationThreshold is the queue length that must be exceeded to scale up from zero
+	// replicas. It only applies when minReplicas is 0.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ActivationThreshold int `json:"activationThreshold,omitempty"`
+	// IdlePeriodSeconds is how long the queue must stay empty before an active QWorker
+	// scales back to zero replicas. It only applies when minReplicas is 0.
+	// +kubebuilder:default=300
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	IdlePeriodSeconds int `json:"idlePeriodSeconds"`
+	// PollingIntervalSeconds is how often the queue is polled. The operator wide polling
+	// interval is used when it is not set.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PollingIntervalSeconds int `json:"pollingIntervalSeconds,omitempty"`
+	// Behavior configures stabilization windows and scaling policies for each direction,
+	// with the semantics of the HorizontalPodAutoscaler behavior. Desired replicas follow
+	// the queue instantly when it is not set.
+	// +optional
+	Behavior *autoscalingv2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+	// Fallback sets the desired replicas once the queue could not be polled for a number of
+	// consecutive polls. The last desired replicas are kept until then, and indefinitely when
+	// it is not set.
+	// +optional
+	Fallback *QWorkerFallback `json:"fallback,omitempty"`
+}
+
+type QWorkerFallback struct {
+	// FailureThreshold is the number of consecutive failed polls after which the desired
+	// replicas are set to Replicas.
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// Replicas are the desired replicas while the queue can not be polled. They must be
+	// between minReplicas and maxReplicas.
+	// +kubebuilder:validation:Minimum=0
+	Replicas int `json:"replicas"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.currentReplicas,selectorpath=.status.selector
 
 type QWorker struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -21,6 +21,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// BrokerFinalizer is set on ScalerConfigs so their broker is closed before they are deleted
+const BrokerFinalizer = "quickube.com/broker"
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 
@@ -34,25 +37,203 @@ type ScalerConfig struct {
 type ScalerConfigSpec struct {
 	Type   string            `json:"type"`
 	Config ScalerTypeConfigs `json:"config"`
+	// HealthCheckIntervalSeconds is how often the broker is probed while it is reachable. The operator
+	// wide health check interval is used when it is not set.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	HealthCheckIntervalSeconds int `json:"healthCheckIntervalSeconds,omitempty"`
 }
 
 type ScalerTypeConfigs struct {
 	RedisConfig `json:",inline"`
+	// +optional
+	RabbitMQConfig *RabbitMQConfig `json:"rabbitmq,omitempty"`
+	// +optional
+	SQSConfig *SQSConfig `json:"sqs,omitempty"`
+	// +optional
+	KafkaConfig *KafkaConfig `json:"kafka,omitempty"`
 }
 
 type RedisConfig struct {
-	Host     string        `json:"host"`
-	Port     string        `json:"port"`
+	// +optional
+	Host string `json:"host,omitempty"`
+	// +optional
+	Port string `json:"port,omitempty"`
+	// Username authenticates as a Redis ACL user. The default user is used when it is not set.
+	// +optional
+	Username string `json:"username,omitempty"`
+	// +optional
+	Password ValueOrSecret `json:"password,omitempty"`
+	// DB is the logical database of the queues. Redis Cluster only supports database 0.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	DB int `json:"db,omitempty"`
+	// TLS connects to the Redis nodes over TLS.
+	// +optional
+	TLS *TLSConfig `json:"tls,omitempty"`
+	// Streams lists the queues that are Redis streams read by a consumer group rather
+	// than lists. The length of a stream queue is the number of entries of the group
+	// that are pending acknowledgement or not delivered yet.
+	// +optional
+	Streams []RedisStream `json:"streams,omitempty"`
+	// Sentinel connects to the master of a Redis Sentinel deployment instead of host and port.
+	// +optional
+	Sentinel *RedisSentinelConfig `json:"sentinel,omitempty"`
+	// Cluster connects to a Redis Cluster instead of host and port.
+	// +optional
+	Cluster *RedisClusterConfig `json:"cluster,omitempty"`
+}
+
+type RedisSentinelConfig struct {
+	// MasterName is the name of the master set monitored by the sentinels.
+	MasterName string `json:"masterName"`
+	// Addresses of the sentinels, as host:port.
+	// +kubebuilder:validation:MinItems=1
+	Addresses []string `json:"addresses"`
+	// Password of the sentinels, when they require one. The password field of the
+	// config authenticates against the master.
+	// +optional
+	Password ValueOrSecret `json:"password,omitempty"`
+}
+
+type RedisClusterConfig struct {
+	// Addresses of the seed nodes of the cluster, as host:port. The other nodes are discovered from them.
+	// +kubebuilder:validation:MinItems=1
+	Addresses []string `json:"addresses"`
+}
+
+type RedisStream struct {
+	// Name is the stream key, as set in the queue of a QWorker.
+	Name string `json:"name"`
+	// ConsumerGroup is the consumer group of the workers on the stream.
+	ConsumerGroup string `json:"consumerGroup"`
+}
+
+type RabbitMQConfig struct {
+	Host string `json:"host"`
+	// Port of the RabbitMQ management HTTP API.
+	// +kubebuilder:default="15672"
+	// +optional
+	Port string `json:"port,omitempty"`
+	// +kubebuilder:default="/"
+	// +optional
+	VHost    string        `json:"vhost,omitempty"`
+	Username string        `json:"username"`
 	Password ValueOrSecret `json:"password"`
+	// UseTLS connects to the management API over HTTPS.
+	// +optional
+	UseTLS bool `json:"useTLS,omitempty"`
+}
+
+type SQSConfig struct {
+	Region string `json:"region"`
+	// Endpoint overrides the SQS endpoint, e.g. to use LocalStack or ElasticMQ.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// AccessKeyID and SecretAccessKey are static AWS credentials. When they are not
+	// set, the default AWS credential chain of the operator is used.
+	// +optional
+	AccessKeyID ValueOrSecret `json:"accessKeyId,omitempty"`
+	// +optional
+	SecretAccessKey ValueOrSecret `json:"secretAccessKey,omitempty"`
+	// +optional
+	SessionToken ValueOrSecret `json:"sessionToken,omitempty"`
+	// IncludeInFlight adds the messages that were received but not deleted yet to the queue length.
+	// +optional
+	IncludeInFlight bool `json:"includeInFlight,omitempty"`
+}
+
+type KafkaConfig struct {
+	// Brokers are the bootstrap addresses of the Kafka cluster, as host:port.
+	// +kubebuilder:validation:MinItems=1
+	Brokers []string `json:"brokers"`
+	// ConsumerGroup is the consumer group whose lag on the QWorker topic is the queue length.
+	ConsumerGroup string `json:"consumerGroup"`
+	// LimitToPartitions caps the replicas of QWorkers at the partition count of their
+	// topic, as extra consumers in a group sit idle.
+	// +optional
+	LimitToPartitions bool `json:"limitToPartitions,omitempty"`
+	// +optional
+	SASL *KafkaSASLConfig `json:"sasl,omitempty"`
+	// +optional
+	TLS *TLSConfig `json:"tls,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=PLAIN;SCRAM-SHA-256;SCRAM-SHA-512
+type KafkaSASLMechanism string
+
+type KafkaSASLConfig struct {
+	// +kubebuilder:default=PLAIN
+	// +optional
+	Mechanism KafkaSASLMechanism `json:"mechanism,omitempty"`
+	Username  ValueOrSecret      `json:"username"`
+	Password  ValueOrSecret      `json:"password"`
+}
+
+type TLSConfig struct {
+	// CA is the PEM encoded certificate authority used to verify the server. The system
+	// certificate authorities are used when it is not set.
+	// +optional
+	CA ValueOrSecret `json:"ca,omitempty"`
+	// Cert and Key are the PEM encoded client certificate and key, for mutual TLS.
+	// +optional
+	Cert ValueOrSecret `json:"cert,omitempty"`
+	// +optional
+	Key ValueOrSecret `json:"key,omitempty"`
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+	// +optional
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
 }
 
+// ValueOrSecret is a plaintext value, or a reference to a secret in one of the secret backends of the operator.
+// At most one of its fields is set.
+// +kubebuilder:validation:MaxProperties=1
 type ValueOrSecret struct {
-	Value  string                    `json:"value,omitempty"`
+	Value string `json:"value,omitempty"`
+	// Secret is a key of a Kubernetes secret in the namespace of the ScalerConfig.
+	// +optional
 	Secret *corev1.SecretKeySelector `json:"secret,omitempty"`
+	// File is the path of a file relative to the directory of the namespace in the secret files
+	// directory of the operator, e.g. a secret mounted by the Secrets Store CSI driver.
+	// +optional
+	File string `json:"file,omitempty"`
+	// Env is an environment variable of the operator. Its name must start with the secret
+	// environment prefix of the operator, the namespace upper cased with its dashes replaced
+	// by underscores, and a double underscore, e.g. QSCALER_SECRET_TEAM_A__REDIS_PASSWORD.
+	// +optional
+	Env string `json:"env,omitempty"`
+	// Vault is a key of a HashiCorp Vault KV v2 secret.
+	// +optional
+	Vault *VaultSecretSelector `json:"vault,omitempty"`
+}
+
+type VaultSecretSelector struct {
+	// Mount is the path the KV v2 secrets engine is mounted at.
+	// +kubebuilder:default=secret
+	// +optional
+	Mount string `json:"mount,omitempty"`
+	// Path of the secret in the secrets engine.
+	Path string `json:"path"`
+	// Key of the value in the data of the secret.
+	Key string `json:"key"`
 }
 
 type ScalerConfigStatus struct {
 	Healthy bool `json:"healthy"`
+	// LastProbeTime is when the broker was last probed.
+	// +optional
+	LastProbeTime *metav1.Time `json:"lastProbeTime,omitempty"`
+	// ProbeLatency is how long the last connection check of the broker took.
+	// +optional
+	ProbeLatency *metav1.Duration `json:"probeLatency,omitempty"`
+	// ConsecutiveFailures counts the failed probes since the broker was last reachable.
+	// +optional
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
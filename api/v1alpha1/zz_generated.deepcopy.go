@@ -21,10 +21,60 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/autoscaling/v2"
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KafkaConfig) DeepCopyInto(out *KafkaConfig) {
+	*out = *in
+	if in.Brokers != nil {
+		in, out := &in.Brokers, &out.Brokers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SASL != nil {
+		in, out := &in.SASL, &out.SASL
+		*out = new(KafkaSASLConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(TLSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KafkaConfig.
+func (in *KafkaConfig) DeepCopy() *KafkaConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(KafkaConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KafkaSASLConfig) DeepCopyInto(out *KafkaSASLConfig) {
+	*out = *in
+	in.Username.DeepCopyInto(&out.Username)
+	in.Password.DeepCopyInto(&out.Password)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KafkaSASLConfig.
+func (in *KafkaSASLConfig) DeepCopy() *KafkaSASLConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(KafkaSASLConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *QWorker) DeepCopyInto(out *QWorker) {
 	*out = *in
@@ -52,6 +102,21 @@ func (in *QWorker) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QWorkerFallback) DeepCopyInto(out *QWorkerFallback) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QWorkerFallback.
+func (in *QWorkerFallback) DeepCopy() *QWorkerFallback {
+	if in == nil {
+		return nil
+	}
+	out := new(QWorkerFallback)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *QWorkerList) DeepCopyInto(out *QWorkerList) {
 	*out = *in
@@ -84,9 +149,59 @@ func (in *QWorkerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QWorkerRolloutStrategy) DeepCopyInto(out *QWorkerRolloutStrategy) {
+	*out = *in
+	if in.MaxSurge != nil {
+		in, out := &in.MaxSurge, &out.MaxSurge
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QWorkerRolloutStrategy.
+func (in *QWorkerRolloutStrategy) DeepCopy() *QWorkerRolloutStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(QWorkerRolloutStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *QWorkerScaleConfig) DeepCopyInto(out *QWorkerScaleConfig) {
 	*out = *in
+	if in.ScalingFactor != nil {
+		in, out := &in.ScalingFactor, &out.ScalingFactor
+		*out = new(int)
+		**out = **in
+	}
+	if in.TargetQueueLengthPerReplica != nil {
+		in, out := &in.TargetQueueLengthPerReplica, &out.TargetQueueLengthPerReplica
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.ThroughputPerReplica != nil {
+		in, out := &in.ThroughputPerReplica, &out.ThroughputPerReplica
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Behavior != nil {
+		in, out := &in.Behavior, &out.Behavior
+		*out = new(v2.HorizontalPodAutoscalerBehavior)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Fallback != nil {
+		in, out := &in.Fallback, &out.Fallback
+		*out = new(QWorkerFallback)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QWorkerScaleConfig.
@@ -103,7 +218,18 @@ func (in *QWorkerScaleConfig) DeepCopy() *QWorkerScaleConfig {
 func (in *QWorkerSpec) DeepCopyInto(out *QWorkerSpec) {
 	*out = *in
 	in.PodSpec.DeepCopyInto(&out.PodSpec)
-	out.ScaleConfig = in.ScaleConfig
+	in.ScaleConfig.DeepCopyInto(&out.ScaleConfig)
+	in.RolloutStrategy.DeepCopyInto(&out.RolloutStrategy)
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int)
+		**out = **in
+	}
+	if in.ManualReplicasTTLSeconds != nil {
+		in, out := &in.ManualReplicasTTLSeconds, &out.ManualReplicasTTLSeconds
+		*out = new(int)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QWorkerSpec.
@@ -119,6 +245,34 @@ func (in *QWorkerSpec) DeepCopy() *QWorkerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *QWorkerStatus) DeepCopyInto(out *QWorkerStatus) {
 	*out = *in
+	if in.EnqueueRate != nil {
+		in, out := &in.EnqueueRate, &out.EnqueueRate
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.DrainRate != nil {
+		in, out := &in.DrainRate, &out.DrainRate
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.LastActiveTime != nil {
+		in, out := &in.LastActiveTime, &out.LastActiveTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Recommendations != nil {
+		in, out := &in.Recommendations, &out.Recommendations
+		*out = make([]ReplicaRecommendation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ScaleEvents != nil {
+		in, out := &in.ScaleEvents, &out.ScaleEvents
+		*out = make([]ScaleEvent, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.MaxContainerResourcesUsage != nil {
 		in, out := &in.MaxContainerResourcesUsage, &out.MaxContainerResourcesUsage
 		*out = make([]v1.ResourceList, len(*in))
@@ -132,6 +286,22 @@ func (in *QWorkerStatus) DeepCopyInto(out *QWorkerStatus) {
 			}
 		}
 	}
+	if in.ManualReplicas != nil {
+		in, out := &in.ManualReplicas, &out.ManualReplicas
+		*out = new(int)
+		**out = **in
+	}
+	if in.ManualReplicasTime != nil {
+		in, out := &in.ManualReplicasTime, &out.ManualReplicasTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QWorkerStatus.
@@ -144,10 +314,66 @@ func (in *QWorkerStatus) DeepCopy() *QWorkerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RabbitMQConfig) DeepCopyInto(out *RabbitMQConfig) {
+	*out = *in
+	in.Password.DeepCopyInto(&out.Password)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RabbitMQConfig.
+func (in *RabbitMQConfig) DeepCopy() *RabbitMQConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RabbitMQConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisClusterConfig) DeepCopyInto(out *RedisClusterConfig) {
+	*out = *in
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisClusterConfig.
+func (in *RedisClusterConfig) DeepCopy() *RedisClusterConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisClusterConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RedisConfig) DeepCopyInto(out *RedisConfig) {
 	*out = *in
 	in.Password.DeepCopyInto(&out.Password)
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(TLSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Streams != nil {
+		in, out := &in.Streams, &out.Streams
+		*out = make([]RedisStream, len(*in))
+		copy(*out, *in)
+	}
+	if in.Sentinel != nil {
+		in, out := &in.Sentinel, &out.Sentinel
+		*out = new(RedisSentinelConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Cluster != nil {
+		in, out := &in.Cluster, &out.Cluster
+		*out = new(RedisClusterConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisConfig.
@@ -160,13 +386,99 @@ func (in *RedisConfig) DeepCopy() *RedisConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisSentinelConfig) DeepCopyInto(out *RedisSentinelConfig) {
+	*out = *in
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.Password.DeepCopyInto(&out.Password)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisSentinelConfig.
+func (in *RedisSentinelConfig) DeepCopy() *RedisSentinelConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisSentinelConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisStream) DeepCopyInto(out *RedisStream) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisStream.
+func (in *RedisStream) DeepCopy() *RedisStream {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisStream)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplicaRecommendation) DeepCopyInto(out *ReplicaRecommendation) {
+	*out = *in
+	in.Timestamp.DeepCopyInto(&out.Timestamp)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicaRecommendation.
+func (in *ReplicaRecommendation) DeepCopy() *ReplicaRecommendation {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplicaRecommendation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SQSConfig) DeepCopyInto(out *SQSConfig) {
+	*out = *in
+	in.AccessKeyID.DeepCopyInto(&out.AccessKeyID)
+	in.SecretAccessKey.DeepCopyInto(&out.SecretAccessKey)
+	in.SessionToken.DeepCopyInto(&out.SessionToken)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQSConfig.
+func (in *SQSConfig) DeepCopy() *SQSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SQSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScaleEvent) DeepCopyInto(out *ScaleEvent) {
+	*out = *in
+	in.Timestamp.DeepCopyInto(&out.Timestamp)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScaleEvent.
+func (in *ScaleEvent) DeepCopy() *ScaleEvent {
+	if in == nil {
+		return nil
+	}
+	out := new(ScaleEvent)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ScalerConfig) DeepCopyInto(out *ScalerConfig) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalerConfig.
@@ -238,6 +550,22 @@ func (in *ScalerConfigSpec) DeepCopy() *ScalerConfigSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ScalerConfigStatus) DeepCopyInto(out *ScalerConfigStatus) {
 	*out = *in
+	if in.LastProbeTime != nil {
+		in, out := &in.LastProbeTime, &out.LastProbeTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ProbeLatency != nil {
+		in, out := &in.ProbeLatency, &out.ProbeLatency
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalerConfigStatus.
@@ -254,6 +582,21 @@ func (in *ScalerConfigStatus) DeepCopy() *ScalerConfigStatus {
 func (in *ScalerTypeConfigs) DeepCopyInto(out *ScalerTypeConfigs) {
 	*out = *in
 	in.RedisConfig.DeepCopyInto(&out.RedisConfig)
+	if in.RabbitMQConfig != nil {
+		in, out := &in.RabbitMQConfig, &out.RabbitMQConfig
+		*out = new(RabbitMQConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SQSConfig != nil {
+		in, out := &in.SQSConfig, &out.SQSConfig
+		*out = new(SQSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KafkaConfig != nil {
+		in, out := &in.KafkaConfig, &out.KafkaConfig
+		*out = new(KafkaConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalerTypeConfigs.
@@ -266,6 +609,24 @@ func (in *ScalerTypeConfigs) DeepCopy() *ScalerTypeConfigs {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TLSConfig) DeepCopyInto(out *TLSConfig) {
+	*out = *in
+	in.CA.DeepCopyInto(&out.CA)
+	in.Cert.DeepCopyInto(&out.Cert)
+	in.Key.DeepCopyInto(&out.Key)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLSConfig.
+func (in *TLSConfig) DeepCopy() *TLSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(TLSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ValueOrSecret) DeepCopyInto(out *ValueOrSecret) {
 	*out = *in
@@ -274,6 +635,11 @@ func (in *ValueOrSecret) DeepCopyInto(out *ValueOrSecret) {
 		*out = new(v1.SecretKeySelector)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Vault != nil {
+		in, out := &in.Vault, &out.Vault
+		*out = new(VaultSecretSelector)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ValueOrSecret.
@@ -285,3 +651,18 @@ func (in *ValueOrSecret) DeepCopy() *ValueOrSecret {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultSecretSelector) DeepCopyInto(out *VaultSecretSelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultSecretSelector.
+func (in *VaultSecretSelector) DeepCopy() *VaultSecretSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultSecretSelector)
+	in.DeepCopyInto(out)
+	return out
+}
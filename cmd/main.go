@@ -20,10 +20,13 @@ import (
 	"crypto/tls"
 	"flag"
 	"os"
+	"time"
 
 	quickcubecomv1alpha1 "github.com/quickube/QScaler/api/v1alpha1"
 	"github.com/quickube/QScaler/internal/controller"
 	"github.com/quickube/QScaler/internal/metrics"
+	"github.com/quickube/QScaler/internal/secret_manager"
+	webhookv1alpha1 "github.com/quickube/QScaler/internal/webhook/v1alpha1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -58,7 +61,15 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var enableWebhooks bool
 	var tlsOpts []func(*tls.Config)
+	var metricsOptions metrics.Options
+	var externalMetricsOptions metrics.ExternalMetricsOptions
+	var healthCheckInterval time.Duration
+	var maxHealthCheckBackoff time.Duration
+	var secretFilesDir string
+	var secretEnvPrefix string
+	var vaultOptions secret_manager.VaultOptions
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -69,6 +80,38 @@ func main() {
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"If set, the defaulting and validating webhooks of QWorker and ScalerConfig are served.")
+	flag.DurationVar(&metricsOptions.PollingInterval, "polling-interval", 5*time.Second,
+		"How often the queues of QWorkers without a pollingIntervalSeconds are polled.")
+	flag.IntVar(&metricsOptions.MaxConcurrentPolls, "max-concurrent-polls", 10,
+		"The number of QWorker queues polled at the same time.")
+	flag.DurationVar(&metricsOptions.PollTimeout, "poll-timeout", 30*time.Second,
+		"How long polling the queue of a single QWorker can take.")
+	flag.DurationVar(&healthCheckInterval, "health-check-interval", 30*time.Second,
+		"How often the brokers of ScalerConfigs without a healthCheckIntervalSeconds are probed while reachable.")
+	flag.DurationVar(&maxHealthCheckBackoff, "max-health-check-backoff", 5*time.Minute,
+		"The longest time between the probes of an unreachable broker, which back off exponentially.")
+	flag.StringVar(&externalMetricsOptions.BindAddress, "external-metrics-bind-address", "0",
+		"The address the external.metrics.k8s.io API server binds to, e.g. :6443. Leave as 0 to disable it.")
+	flag.StringVar(&externalMetricsOptions.CertDir, "external-metrics-cert-dir", "",
+		"The directory with the tls.crt and tls.key of the external metrics server. A self-signed certificate is used if empty.")
+	flag.StringVar(&externalMetricsOptions.ClientCAFile, "external-metrics-client-ca-file", "",
+		"The CA of the client certificates of the API server aggregator. "+
+			"Read from the extension-apiserver-authentication ConfigMap of kube-system if empty.")
+	flag.StringVar(&secretFilesDir, "secret-files-dir", "/etc/qscaler/secrets",
+		"The directory the file secrets of ScalerConfigs are read from, in a subdirectory per namespace.")
+	flag.StringVar(&secretEnvPrefix, "secret-env-prefix", "QSCALER_SECRET_",
+		"The prefix of the environment variables the env secrets of ScalerConfigs can be read from, "+
+			"followed by the namespace of the ScalerConfig and a double underscore.")
+	flag.StringVar(&vaultOptions.Address, "vault-address", "",
+		"The address of the Vault server vault secrets are read from. Leave empty to disable vault secrets.")
+	flag.StringVar(&vaultOptions.Role, "vault-role", "qscaler",
+		"The role of the Vault Kubernetes auth method the operator logs in as.")
+	flag.StringVar(&vaultOptions.AuthMount, "vault-auth-mount", "kubernetes",
+		"The path the Vault Kubernetes auth method is mounted at.")
+	flag.StringVar(&vaultOptions.TokenPath, "vault-token-path", secret_manager.DefaultServiceAccountTokenPath,
+		"The service account token the operator logs in to Vault with.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -92,6 +135,8 @@ func main() {
 		tlsOpts = append(tlsOpts, disableHTTP2)
 	}
 
+	externalMetricsOptions.TLSOpts = tlsOpts
+
 	webhookServer := webhook.NewServer(webhook.Options{
 		TLSOpts: tlsOpts,
 	})
@@ -142,6 +187,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// secrets referenced by ScalerConfigs are read from their namespace through the cache of the manager
+	secret_manager.SetClient(mgr.GetClient())
+	secret_manager.RegisterBackend(secret_manager.FileBackend, secret_manager.NewFileBackend(secretFilesDir))
+	secret_manager.RegisterBackend(secret_manager.EnvBackend, secret_manager.NewEnvBackend(secretEnvPrefix))
+	if vaultOptions.Address != "" {
+		secret_manager.RegisterBackend(secret_manager.VaultBackend, secret_manager.NewVaultBackend(vaultOptions))
+	}
+
 	if err = (&controller.QWorkerReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
@@ -151,14 +204,37 @@ func main() {
 	}
 
 	if err = (&controller.ScalerConfigReconciler{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		Recorder: mgr.GetEventRecorderFor("ScalerConfig"),
+		Client:                mgr.GetClient(),
+		Scheme:                mgr.GetScheme(),
+		Recorder:              mgr.GetEventRecorderFor("ScalerConfig"),
+		HealthCheckInterval:   healthCheckInterval,
+		MaxHealthCheckBackoff: maxHealthCheckBackoff,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ScalerConfig")
 		os.Exit(1)
 	}
 
+	if enableWebhooks {
+		if err = webhookv1alpha1.SetupQWorkerWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "QWorker")
+			os.Exit(1)
+		}
+		if err = webhookv1alpha1.SetupScalerConfigWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ScalerConfig")
+			os.Exit(1)
+		}
+	}
+
+	if err = metrics.SetupWithManager(mgr, metricsOptions); err != nil {
+		setupLog.Error(err, "unable to set up metrics server")
+		os.Exit(1)
+	}
+
+	if err = metrics.SetupExternalMetricsWithManager(mgr, externalMetricsOptions); err != nil {
+		setupLog.Error(err, "unable to set up external metrics server")
+		os.Exit(1)
+	}
+
 	// +kubebuilder:scaffold:builder
 
 	if err = mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -171,12 +247,8 @@ func main() {
 		os.Exit(1)
 	}
 
-	ctx := ctrl.SetupSignalHandler()
-
-	metrics.StartServer(ctx, mgr)
-
 	setupLog.Info("starting manager")
-	if err = mgr.Start(ctx); err != nil {
+	if err = mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
@@ -0,0 +1,233 @@
+package brokers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/quickube/QScaler/internal/secret_manager"
+	"github.com/xdg-go/scram"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var (
+	// kafkaRequestTimeout bounds each request to the Kafka brokers, so a poll overruns its deadline by one request at most
+	kafkaRequestTimeout = 10 * time.Second
+)
+
+// KafkaBroker reports the lag of a consumer group on a topic as its queue length
+type KafkaBroker struct {
+	client            sarama.Client
+	admin             sarama.ClusterAdmin
+	consumerGroup     string
+	limitToPartitions bool
+}
+
+type KafkaConfig struct {
+	Brokers           []string                  `yaml:"brokers"`
+	ConsumerGroup     string                    `yaml:"consumerGroup"`
+	LimitToPartitions bool                      `yaml:"limitToPartitions"`
+	SASL              *v1alpha1.KafkaSASLConfig `yaml:"sasl"`
+	TLS               *v1alpha1.TLSConfig       `yaml:"tls"`
+}
+
+// GetQueueLength returns the total lag of the consumer group across the partitions of the topic.
+// Partitions the group never committed an offset on count every message they retain.
+func (k *KafkaBroker) GetQueueLength(ctx *context.Context, topic string) (int, error) {
+	// sarama takes no context, so the deadline of the poll is checked between requests
+	if err := (*ctx).Err(); err != nil {
+		return -1, err
+	}
+	if err := k.client.RefreshMetadata(topic); err != nil {
+		return -1, err
+	}
+	partitions, err := k.client.Partitions(topic)
+	if err != nil {
+		return -1, err
+	}
+
+	offsets, err := k.admin.ListConsumerGroupOffsets(k.consumerGroup, map[string][]int32{topic: partitions})
+	if err != nil {
+		return -1, err
+	}
+	if offsets.Err != sarama.ErrNoError {
+		return -1, offsets.Err
+	}
+
+	var lag int64
+	for _, partition := range partitions {
+		if err := (*ctx).Err(); err != nil {
+			return -1, err
+		}
+		newestOffset, err := k.client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return -1, err
+		}
+
+		committedOffset := int64(-1)
+		if block := offsets.GetBlock(topic, partition); block != nil {
+			if block.Err != sarama.ErrNoError {
+				return -1, block.Err
+			}
+			committedOffset = block.Offset
+		}
+		if committedOffset < 0 {
+			committedOffset, err = k.client.GetOffset(topic, partition, sarama.OffsetOldest)
+			if err != nil {
+				return -1, err
+			}
+		}
+
+		lag += max(0, newestOffset-committedOffset)
+	}
+	return int(lag), nil
+}
+
+func (k *KafkaBroker) IsConnected(ctx *context.Context) (bool, error) {
+	if _, err := k.client.Controller(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Close closes the cluster admin, which closes the client it was created from
+func (k *KafkaBroker) Close() error {
+	return k.admin.Close()
+}
+
+// GetMaxConsumers returns the partition count of the topic when replicas are limited to it
+func (k *KafkaBroker) GetMaxConsumers(ctx *context.Context, topic string) (int, error) {
+	if !k.limitToPartitions {
+		return 0, nil
+	}
+	partitions, err := k.client.Partitions(topic)
+	if err != nil {
+		return 0, err
+	}
+	return len(partitions), nil
+}
+
+func init() {
+	RegisterBrokerType("kafka", NewTypedBrokerFactory(
+		func(c *v1alpha1.ScalerTypeConfigs) *v1alpha1.KafkaConfig { return c.KafkaConfig }, NewKafkaClient),
+		validateKafkaConfig)
+}
+
+// validateKafkaConfig requires the broker addresses and the consumer group whose lag is the queue length
+func validateKafkaConfig(config *v1alpha1.ScalerTypeConfigs, path *field.Path) field.ErrorList {
+	if config.KafkaConfig == nil {
+		return field.ErrorList{field.Required(path.Child("kafka"), "is required by the kafka type")}
+	}
+
+	var allErrs field.ErrorList
+	if len(config.KafkaConfig.Brokers) == 0 {
+		allErrs = append(allErrs, field.Required(path.Child("kafka", "brokers"), "at least one broker address is required"))
+	}
+	if config.KafkaConfig.ConsumerGroup == "" {
+		allErrs = append(allErrs, field.Required(path.Child("kafka", "consumerGroup"), ""))
+	}
+	return allErrs
+}
+
+func NewKafkaClient(kafkaConfig *KafkaConfig, secretManager secret_manager.SecretManager) (*KafkaBroker, error) {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.ClientID = "qscaler"
+	saramaConfig.Net.DialTimeout = kafkaRequestTimeout
+	saramaConfig.Net.ReadTimeout = kafkaRequestTimeout
+	saramaConfig.Net.WriteTimeout = kafkaRequestTimeout
+
+	if kafkaConfig.SASL != nil {
+		if err := configureSASL(saramaConfig, secretManager, kafkaConfig.SASL); err != nil {
+			return nil, err
+		}
+	}
+
+	if kafkaConfig.TLS != nil {
+		tlsConfig, err := newTLSConfig(secretManager, kafkaConfig.TLS)
+		if err != nil {
+			return nil, err
+		}
+		saramaConfig.Net.TLS.Enable = true
+		saramaConfig.Net.TLS.Config = tlsConfig
+	}
+
+	return newKafkaBroker(kafkaConfig, saramaConfig)
+}
+
+func newKafkaBroker(config *KafkaConfig, saramaConfig *sarama.Config) (*KafkaBroker, error) {
+	client, err := sarama.NewClient(config.Brokers, saramaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	return &KafkaBroker{
+		client:            client,
+		admin:             admin,
+		consumerGroup:     config.ConsumerGroup,
+		limitToPartitions: config.LimitToPartitions,
+	}, nil
+}
+
+func configureSASL(saramaConfig *sarama.Config, secretManager secret_manager.SecretManager, config *v1alpha1.KafkaSASLConfig) error {
+	username, err := secretManager.Get(config.Username)
+	if err != nil {
+		return err
+	}
+	password, err := secretManager.Get(config.Password)
+	if err != nil {
+		return err
+	}
+
+	saramaConfig.Net.SASL.Enable = true
+	saramaConfig.Net.SASL.User = username
+	saramaConfig.Net.SASL.Password = password
+
+	switch config.Mechanism {
+	case "", "PLAIN":
+		saramaConfig.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case "SCRAM-SHA-256":
+		saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hashGenerator: scram.SHA256}
+		}
+	case "SCRAM-SHA-512":
+		saramaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		saramaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hashGenerator: scram.SHA512}
+		}
+	default:
+		return fmt.Errorf("unsupported kafka sasl mechanism: %s", config.Mechanism)
+	}
+	return nil
+}
+
+// scramClient implements sarama.SCRAMClient on top of xdg-go/scram
+type scramClient struct {
+	hashGenerator scram.HashGeneratorFcn
+	conversation  *scram.ClientConversation
+}
+
+func (s *scramClient) Begin(userName, password, authzID string) error {
+	client, err := s.hashGenerator.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	s.conversation = client.NewConversation()
+	return nil
+}
+
+func (s *scramClient) Step(challenge string) (string, error) {
+	return s.conversation.Step(challenge)
+}
+
+func (s *scramClient) Done() bool {
+	return s.conversation.Done()
+}
@@ -0,0 +1,86 @@
+package brokers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKafkaTestBroker(t *testing.T, limitToPartitions bool) *KafkaBroker {
+	mockBroker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(mockBroker.Close)
+
+	mockBroker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(mockBroker.Addr(), mockBroker.BrokerID()).
+			SetController(mockBroker.BrokerID()).
+			SetLeader("tasks", 0, mockBroker.BrokerID()).
+			SetLeader("tasks", 1, mockBroker.BrokerID()).
+			SetLeader("tasks", 2, mockBroker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("tasks", 0, sarama.OffsetNewest, 100).
+			SetOffset("tasks", 1, sarama.OffsetNewest, 50).
+			SetOffset("tasks", 2, sarama.OffsetNewest, 30).
+			SetOffset("tasks", 2, sarama.OffsetOldest, 10),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "workers", mockBroker),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("workers", "tasks", 0, 90, "", sarama.ErrNoError).
+			SetOffset("workers", "tasks", 1, 50, "", sarama.ErrNoError).
+			SetOffset("workers", "tasks", 2, -1, "", sarama.ErrNoError),
+	})
+
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Version = sarama.V2_1_0_0
+	broker, err := newKafkaBroker(&KafkaConfig{
+		Brokers:           []string{mockBroker.Addr()},
+		ConsumerGroup:     "workers",
+		LimitToPartitions: limitToPartitions,
+	}, saramaConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = broker.client.Close() })
+	return broker
+}
+
+func TestKafkaBroker_GetQueueLength(t *testing.T) {
+	broker := newKafkaTestBroker(t, false)
+	ctx := context.Background()
+
+	// 10 on partition 0, none on partition 1 and 20 retained on the uncommitted partition 2
+	length, err := broker.GetQueueLength(&ctx, "tasks")
+	require.NoError(t, err)
+	assert.Equal(t, 30, length)
+}
+
+func TestKafkaBroker_GetQueueLength_ContextDone(t *testing.T) {
+	broker := newKafkaTestBroker(t, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := broker.GetQueueLength(&ctx, "tasks")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestKafkaBroker_IsConnected(t *testing.T) {
+	broker := newKafkaTestBroker(t, false)
+	ctx := context.Background()
+
+	connected, err := broker.IsConnected(&ctx)
+	require.NoError(t, err)
+	assert.True(t, connected)
+}
+
+func TestKafkaBroker_GetMaxConsumers(t *testing.T) {
+	ctx := context.Background()
+
+	maxConsumers, err := newKafkaTestBroker(t, false).GetMaxConsumers(&ctx, "tasks")
+	require.NoError(t, err)
+	assert.Equal(t, 0, maxConsumers)
+
+	maxConsumers, err = newKafkaTestBroker(t, true).GetMaxConsumers(&ctx, "tasks")
+	require.NoError(t, err)
+	assert.Equal(t, 3, maxConsumers)
+}
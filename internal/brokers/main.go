@@ -2,60 +2,244 @@ package brokers
 
 import (
 	"fmt"
-
+	"slices"
 	"sync"
+	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/quickube/QScaler/internal/secret_manager"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// BrokerFactory creates the broker of a ScalerConfig
+type BrokerFactory func(config *v1alpha1.ScalerConfig) (Broker, error)
+
+// ConfigValidator returns the errors of the config of a broker type, whose fields are found under path. It lets
+// the ScalerConfig webhook reject invalid configs before their broker is created.
+type ConfigValidator func(config *v1alpha1.ScalerTypeConfigs, path *field.Path) field.ErrorList
+
+// brokerType is how the brokers of a ScalerConfig type are created and their configs validated
+type brokerType struct {
+	factory  BrokerFactory
+	validate ConfigValidator
+}
+
+// brokerCloseGracePeriod is how long a broker dropped from the registry stays open, so polls that got it
+// before can finish
+var brokerCloseGracePeriod = time.Minute
+
+// brokerVersion identifies the ScalerConfig a broker was created from
+type brokerVersion struct {
+	uid        types.UID
+	generation int64
+}
+
 var (
+	// BrokerRegistry holds the broker of every ScalerConfig, keyed by namespace/name
 	BrokerRegistry = make(map[string]Broker)
-	registryMutex  sync.Mutex
+	// brokerVersions holds the version of the ScalerConfig each broker of the registry was created from
+	brokerVersions = make(map[string]brokerVersion)
+	// creationMutexes serialize the creation of the broker of each ScalerConfig
+	creationMutexes = make(map[string]*sync.Mutex)
+	registryMutex   sync.Mutex
+
+	// brokerTypes holds every broker type, keyed by ScalerConfig type
+	brokerTypes      = make(map[string]brokerType)
+	brokerTypesMutex sync.RWMutex
 )
 
+// RegisterBrokerType makes a broker type available to ScalerConfigs. Brokers register themselves from the
+// init function of their file. validate may be nil for types whose config is only checked when their broker
+// is created. It panics if the type is already registered.
+func RegisterBrokerType(name string, factory BrokerFactory, validate ConfigValidator) {
+	brokerTypesMutex.Lock()
+	defer brokerTypesMutex.Unlock()
+
+	if _, exists := brokerTypes[name]; exists {
+		panic(fmt.Sprintf("broker type %s is already registered", name))
+	}
+	brokerTypes[name] = brokerType{factory: factory, validate: validate}
+}
+
+// UnregisterBrokerType removes a broker type, so tests can clean up the fake types they register
+func UnregisterBrokerType(name string) {
+	brokerTypesMutex.Lock()
+	defer brokerTypesMutex.Unlock()
+	delete(brokerTypes, name)
+}
+
+// ValidateConfig validates the config of a ScalerConfig with the validator of its broker type, whose fields
+// are found under path. It returns false if the type is not registered.
+func ValidateConfig(config *v1alpha1.ScalerConfig, path *field.Path) (field.ErrorList, bool) {
+	brokerTypesMutex.RLock()
+	registered, exists := brokerTypes[config.Spec.Type]
+	brokerTypesMutex.RUnlock()
+	if !exists {
+		return nil, false
+	}
+	if registered.validate == nil {
+		return nil, true
+	}
+	return registered.validate(&config.Spec.Config, path), true
+}
+
+// SupportedTypes returns the registered broker types, sorted
+func SupportedTypes() []string {
+	brokerTypesMutex.RLock()
+	defer brokerTypesMutex.RUnlock()
+
+	types := make([]string, 0, len(brokerTypes))
+	for name := range brokerTypes {
+		types = append(types, name)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// NewTypedBrokerFactory returns a factory that decodes the section of the ScalerConfig config selected by
+// section into the config type of the broker, and creates the broker from it with a secret manager of the
+// namespace of the ScalerConfig. A missing section is an error.
+func NewTypedBrokerFactory[S any, C any, B Broker](section func(*v1alpha1.ScalerTypeConfigs) *S,
+	create func(*C, secret_manager.SecretManager) (B, error)) BrokerFactory {
+	return func(config *v1alpha1.ScalerConfig) (Broker, error) {
+		typeConfig := section(&config.Spec.Config)
+		if typeConfig == nil {
+			return nil, fmt.Errorf("missing %s config", config.Spec.Type)
+		}
+
+		brokerConfig := new(C)
+		if err := mapstructure.Decode(typeConfig, brokerConfig); err != nil {
+			return nil, fmt.Errorf("invalid %s config: %w", config.Spec.Type, err)
+		}
+
+		secretManager, err := secret_manager.NewClient(config.Namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		broker, err := create(brokerConfig, secretManager)
+		if err != nil {
+			return nil, err
+		}
+		return broker, nil
+	}
+}
+
 func GetBroker(namespace string, name string) (Broker, error) {
 	configKey := fmt.Sprintf("%s/%s", namespace, name)
 
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
 	if broker, exists := BrokerRegistry[configKey]; exists {
 		return broker, nil
 	}
 	return nil, fmt.Errorf("broker not found for %s", configKey)
 }
 
-func NewBroker(config *v1alpha1.ScalerConfig) (Broker, error) {
-	switch config.Spec.Type {
-	case "redis":
-		redisClient, err := updateBroker(config, func() (Broker, error) { return NewRedisClient(config) })
-		if err != nil {
-			return nil, fmt.Errorf("failed to initialize Redis broker: %w", err)
-		}
-		return redisClient, nil
-	default:
-		// Check if the broker already exists
-		if broker, exists := BrokerRegistry[config.Spec.Type]; exists {
-			return broker, nil
-		}
+// GetOrCreateBroker returns the broker of a ScalerConfig from the registry, or creates it with the factory of
+// its type when the ScalerConfig is new or changed since. The broker it replaces is closed.
+func GetOrCreateBroker(config *v1alpha1.ScalerConfig) (Broker, error) {
+	configKey := fmt.Sprintf("%s/%s", config.Namespace, config.Name)
+	if config.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("ScalerConfig %s is being deleted", configKey)
+	}
+
+	brokerTypesMutex.RLock()
+	registered, exists := brokerTypes[config.Spec.Type]
+	brokerTypesMutex.RUnlock()
+	if !exists {
 		return nil, fmt.Errorf("unsupported broker type: %s", config.Spec.Type)
 	}
-}
 
-func updateBroker(config *v1alpha1.ScalerConfig, createFunc func() (Broker, error)) (Broker, error) {
-	configKey := fmt.Sprintf("%s/%s", config.Namespace, config.Name)
-	// Ensure thread-safe access to the registry
+	// the QWorkers of a ScalerConfig are polled concurrently, but its broker is created once
+	creationMutex := lockBrokerCreation(configKey)
+	defer creationMutex.Unlock()
+
+	version := brokerVersion{uid: config.UID, generation: config.Generation}
 	registryMutex.Lock()
-	defer registryMutex.Unlock()
+	broker, exists := BrokerRegistry[configKey]
+	cachedVersion, versioned := brokerVersions[configKey]
+	registryMutex.Unlock()
+	if exists && versioned && cachedVersion == version {
+		return broker, nil
+	}
 
-	_, exists := BrokerRegistry[configKey]
-	if exists {
+	// Create the broker before locking, so a slow broker does not block the others
+	broker, err := registered.factory(config)
+
+	registryMutex.Lock()
+	replaced, exists := BrokerRegistry[configKey]
+	if err == nil {
+		BrokerRegistry[configKey] = broker
+		brokerVersions[configKey] = version
+	} else {
+		// the broker of the previous config is dropped as well, so it is not used once the config changed
 		delete(BrokerRegistry, configKey)
+		delete(brokerVersions, configKey)
 	}
+	registryMutex.Unlock()
 
-	broker, err := createFunc()
+	if exists && replaced != broker {
+		closeBroker(configKey, replaced)
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to initialize %s broker: %w", config.Spec.Type, err)
 	}
-
-	// Store the broker in the registry
-	BrokerRegistry[configKey] = broker
 	return broker, nil
 }
+
+// RemoveBroker drops the broker of a ScalerConfig from the registry and closes it, so it is created again
+// the next time it is needed. A broker being created is removed once its creation is done.
+func RemoveBroker(namespace string, name string) {
+	configKey := fmt.Sprintf("%s/%s", namespace, name)
+
+	creationMutex := lockBrokerCreation(configKey)
+	defer creationMutex.Unlock()
+
+	registryMutex.Lock()
+	broker, exists := BrokerRegistry[configKey]
+	delete(BrokerRegistry, configKey)
+	delete(brokerVersions, configKey)
+	delete(creationMutexes, configKey)
+	registryMutex.Unlock()
+
+	if exists {
+		closeBroker(configKey, broker)
+	}
+}
+
+// lockBrokerCreation locks the creation of the broker of a ScalerConfig and returns the locked mutex
+func lockBrokerCreation(configKey string) *sync.Mutex {
+	for {
+		registryMutex.Lock()
+		creationMutex, exists := creationMutexes[configKey]
+		if !exists {
+			creationMutex = &sync.Mutex{}
+			creationMutexes[configKey] = creationMutex
+		}
+		registryMutex.Unlock()
+
+		creationMutex.Lock()
+		// RemoveBroker drops the mutex while holding it, so a mutex dropped while waiting is replaced by a new one
+		registryMutex.Lock()
+		current := creationMutexes[configKey]
+		registryMutex.Unlock()
+		if current == creationMutex {
+			return creationMutex
+		}
+		creationMutex.Unlock()
+	}
+}
+
+// closeBroker closes a broker dropped from the registry once polls that got it before have had time to finish
+func closeBroker(configKey string, broker Broker) {
+	time.AfterFunc(brokerCloseGracePeriod, func() {
+		if err := broker.Close(); err != nil {
+			log.Log.Error(err, "Failed to close broker", "scalerConfig", configKey)
+		}
+	})
+}
@@ -0,0 +1,241 @@
+package brokers
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/quickube/QScaler/internal/mocks"
+	"github.com/quickube/QScaler/internal/secret_manager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRegisterBrokerType(t *testing.T) {
+	brokerMock := &mocks.Broker{}
+	RegisterBrokerType("test-registered", func(*v1alpha1.ScalerConfig) (Broker, error) { return brokerMock, nil }, nil)
+	t.Cleanup(func() { UnregisterBrokerType("test-registered") })
+
+	assert.Contains(t, SupportedTypes(), "test-registered")
+	assert.Panics(t, func() {
+		RegisterBrokerType("test-registered", func(*v1alpha1.ScalerConfig) (Broker, error) { return brokerMock, nil }, nil)
+	})
+
+	config := &v1alpha1.ScalerConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "registered", Namespace: "default"},
+		Spec:       v1alpha1.ScalerConfigSpec{Type: "test-registered"},
+	}
+	broker, err := GetOrCreateBroker(config)
+	require.NoError(t, err)
+	assert.Same(t, brokerMock, broker)
+
+	registered, err := GetBroker("default", "registered")
+	require.NoError(t, err)
+	assert.Same(t, brokerMock, registered)
+	RemoveBroker("default", "registered")
+}
+
+func TestGetOrCreateBroker(t *testing.T) {
+	gracePeriod := brokerCloseGracePeriod
+	brokerCloseGracePeriod = 0
+	t.Cleanup(func() { brokerCloseGracePeriod = gracePeriod })
+
+	var created []*mocks.Broker
+	var closed []*atomic.Int32
+	RegisterBrokerType("test-cached", func(*v1alpha1.ScalerConfig) (Broker, error) {
+		closes := &atomic.Int32{}
+		brokerMock := &mocks.Broker{}
+		brokerMock.On("Close").Run(func(mock.Arguments) { closes.Add(1) }).Return(nil)
+		created = append(created, brokerMock)
+		closed = append(closed, closes)
+		return brokerMock, nil
+	}, nil)
+	t.Cleanup(func() { UnregisterBrokerType("test-cached") })
+
+	config := &v1alpha1.ScalerConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "cached", Namespace: "default", UID: "uid-1", Generation: 1},
+		Spec:       v1alpha1.ScalerConfigSpec{Type: "test-cached"},
+	}
+	first, err := GetOrCreateBroker(config)
+	require.NoError(t, err)
+	second, err := GetOrCreateBroker(config.DeepCopy())
+	require.NoError(t, err)
+	assert.Same(t, first, second, "the broker of an unchanged ScalerConfig should be reused")
+	require.Len(t, created, 1)
+
+	config.Generation = 2
+	changed, err := GetOrCreateBroker(config)
+	require.NoError(t, err)
+	assert.NotSame(t, first, changed, "a changed ScalerConfig should get a new broker")
+	assert.Eventually(t, func() bool { return closed[0].Load() == 1 }, time.Second, 10*time.Millisecond,
+		"the replaced broker should be closed")
+
+	config.UID = "uid-2"
+	config.Generation = 1
+	recreated, err := GetOrCreateBroker(config)
+	require.NoError(t, err)
+	assert.NotSame(t, changed, recreated, "a ScalerConfig created again with the same name should get a new broker")
+
+	RemoveBroker("default", "cached")
+	assert.Eventually(t, func() bool { return closed[2].Load() == 1 }, time.Second, 10*time.Millisecond,
+		"the removed broker should be closed")
+	_, err = GetBroker("default", "cached")
+	assert.Error(t, err)
+	RemoveBroker("default", "cached")
+
+	config.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	_, err = GetOrCreateBroker(config)
+	assert.Error(t, err, "no broker should be created for a ScalerConfig being deleted")
+	assert.Len(t, created, 3)
+	assert.Eventually(t, func() bool { return closed[1].Load() == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestRemoveBroker_WhileCreating(t *testing.T) {
+	gracePeriod := brokerCloseGracePeriod
+	brokerCloseGracePeriod = 0
+	t.Cleanup(func() { brokerCloseGracePeriod = gracePeriod })
+
+	var created, creating atomic.Int32
+	var overlapped atomic.Bool
+	started, release := make(chan struct{}), make(chan struct{})
+	RegisterBrokerType("test-removed", func(*v1alpha1.ScalerConfig) (Broker, error) {
+		if creating.Add(1) > 1 {
+			overlapped.Store(true)
+		}
+		defer creating.Add(-1)
+		if created.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		brokerMock := &mocks.Broker{}
+		brokerMock.On("Close").Return(nil)
+		return brokerMock, nil
+	}, nil)
+	t.Cleanup(func() { UnregisterBrokerType("test-removed") })
+
+	config := &v1alpha1.ScalerConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "removed", Namespace: "default"},
+		Spec:       v1alpha1.ScalerConfigSpec{Type: "test-removed"},
+	}
+	done := make(chan struct{}, 3)
+	go func() { _, _ = GetOrCreateBroker(config); done <- struct{}{} }()
+	<-started
+	go func() { RemoveBroker("default", "removed"); done <- struct{}{} }()
+	// let the removal run up to the creation lock before the next creation
+	time.Sleep(50 * time.Millisecond)
+	go func() { _, _ = GetOrCreateBroker(config); done <- struct{}{} }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for range 3 {
+		<-done
+	}
+
+	assert.False(t, overlapped.Load(), "a broker should not be created while another one is being created")
+	RemoveBroker("default", "removed")
+}
+
+func TestGetOrCreateBroker_UnsupportedType(t *testing.T) {
+	config := &v1alpha1.ScalerConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "unsupported", Namespace: "default"},
+		Spec:       v1alpha1.ScalerConfigSpec{Type: "rediss"},
+	}
+	_, err := GetOrCreateBroker(config)
+	assert.EqualError(t, err, "unsupported broker type: rediss")
+}
+
+func TestNewTypedBrokerFactory(t *testing.T) {
+	secret_manager.SetClient(fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "team-a"},
+		Data:       map[string][]byte{"accessKeyId": []byte("AKIA")},
+	}).Build())
+	t.Cleanup(func() { secret_manager.SetClient(nil) })
+
+	var decoded *SQSConfig
+	var accessKeyID string
+	factory := NewTypedBrokerFactory(
+		func(c *v1alpha1.ScalerTypeConfigs) *v1alpha1.SQSConfig { return c.SQSConfig },
+		func(config *SQSConfig, secretManager secret_manager.SecretManager) (*SQSBroker, error) {
+			decoded = config
+			var err error
+			accessKeyID, err = secretManager.Get(config.AccessKeyID)
+			return &SQSBroker{}, err
+		})
+
+	config := &v1alpha1.ScalerConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "sqs", Namespace: "team-a"},
+		Spec:       v1alpha1.ScalerConfigSpec{Type: "sqs"},
+	}
+	_, err := factory(config)
+	assert.EqualError(t, err, "missing sqs config")
+
+	config.Spec.Config.SQSConfig = &v1alpha1.SQSConfig{
+		Region:          "us-east-1",
+		IncludeInFlight: true,
+		AccessKeyID: v1alpha1.ValueOrSecret{Secret: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "aws"},
+			Key:                  "accessKeyId",
+		}},
+	}
+	broker, err := factory(config)
+	require.NoError(t, err)
+	assert.IsType(t, &SQSBroker{}, broker)
+	assert.Equal(t, "us-east-1", decoded.Region)
+	assert.True(t, decoded.IncludeInFlight)
+	assert.Equal(t, "AKIA", accessKeyID, "secrets should be read from the namespace of the ScalerConfig")
+
+	config.Namespace = "team-b"
+	_, err = factory(config)
+	assert.Error(t, err, "secrets of other namespaces should not be read")
+}
+
+func TestUnregisterBrokerType(t *testing.T) {
+	RegisterBrokerType("test-unregistered", func(*v1alpha1.ScalerConfig) (Broker, error) { return &mocks.Broker{}, nil }, nil)
+	UnregisterBrokerType("test-unregistered")
+	assert.NotContains(t, SupportedTypes(), "test-unregistered")
+}
+
+func TestValidateConfig(t *testing.T) {
+	configPath := field.NewPath("spec", "config")
+	RegisterBrokerType("test-validated", func(*v1alpha1.ScalerConfig) (Broker, error) { return &mocks.Broker{}, nil },
+		func(config *v1alpha1.ScalerTypeConfigs, path *field.Path) field.ErrorList {
+			if config.SQSConfig == nil {
+				return field.ErrorList{field.Required(path.Child("sqs"), "")}
+			}
+			return nil
+		})
+	t.Cleanup(func() { UnregisterBrokerType("test-validated") })
+	RegisterBrokerType("test-unvalidated", func(*v1alpha1.ScalerConfig) (Broker, error) { return &mocks.Broker{}, nil }, nil)
+	t.Cleanup(func() { UnregisterBrokerType("test-unvalidated") })
+
+	config := &v1alpha1.ScalerConfig{Spec: v1alpha1.ScalerConfigSpec{Type: "test-validated"}}
+	errs, supported := ValidateConfig(config, configPath)
+	assert.True(t, supported)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "spec.config.sqs", errs[0].Field)
+
+	config.Spec.Config.SQSConfig = &v1alpha1.SQSConfig{}
+	errs, supported = ValidateConfig(config, configPath)
+	assert.True(t, supported)
+	assert.Empty(t, errs)
+
+	config.Spec.Type = "test-unvalidated"
+	errs, supported = ValidateConfig(config, configPath)
+	assert.True(t, supported)
+	assert.Empty(t, errs)
+
+	config.Spec.Type = "test-missing"
+	_, supported = ValidateConfig(config, configPath)
+	assert.False(t, supported)
+}
+
+func TestBuiltinBrokerTypes(t *testing.T) {
+	for _, brokerType := range []string{"kafka", "rabbitmq", "redis", "sqs"} {
+		assert.Contains(t, SupportedTypes(), brokerType)
+	}
+}
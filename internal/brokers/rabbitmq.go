@@ -0,0 +1,132 @@
+package brokers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/quickube/QScaler/internal/secret_manager"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var (
+	rabbitMQRequestTimeout = 10 * time.Second
+)
+
+// RabbitMQBroker reads queue depths from the RabbitMQ management HTTP API
+type RabbitMQBroker struct {
+	client   *http.Client
+	baseURL  string
+	vhost    string
+	username string
+	password string
+}
+
+type RabbitMQConfig struct {
+	Host     string                 `yaml:"host"`
+	Port     string                 `yaml:"port"`
+	VHost    string                 `yaml:"vhost"`
+	Username string                 `yaml:"username"`
+	Password v1alpha1.ValueOrSecret `yaml:"password"`
+	UseTLS   bool                   `yaml:"useTLS"`
+}
+
+type rabbitMQQueue struct {
+	Messages int `json:"messages"`
+}
+
+func (r *RabbitMQBroker) GetQueueLength(ctx *context.Context, topic string) (int, error) {
+	queue := &rabbitMQQueue{}
+	path := fmt.Sprintf("/api/queues/%s/%s", url.PathEscape(r.vhost), url.PathEscape(topic))
+	if err := r.get(*ctx, path, queue); err != nil {
+		return -1, err
+	}
+	// messages counts both the ready and the unacknowledged messages of the queue
+	return queue.Messages, nil
+}
+
+func (r *RabbitMQBroker) IsConnected(ctx *context.Context) (bool, error) {
+	err := r.get(*ctx, fmt.Sprintf("/api/vhosts/%s", url.PathEscape(r.vhost)), nil)
+	return err == nil, err
+}
+
+// Close drops the idle connections to the management API
+func (r *RabbitMQBroker) Close() error {
+	r.client.CloseIdleConnections()
+	return nil
+}
+
+func (r *RabbitMQBroker) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.username, r.password)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rabbitmq management API returned %s for %s", resp.Status, path)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func init() {
+	RegisterBrokerType("rabbitmq", NewTypedBrokerFactory(
+		func(c *v1alpha1.ScalerTypeConfigs) *v1alpha1.RabbitMQConfig { return c.RabbitMQConfig }, NewRabbitMQClient),
+		validateRabbitMQConfig)
+}
+
+// validateRabbitMQConfig requires the host of the management API
+func validateRabbitMQConfig(config *v1alpha1.ScalerTypeConfigs, path *field.Path) field.ErrorList {
+	if config.RabbitMQConfig == nil {
+		return field.ErrorList{field.Required(path.Child("rabbitmq"), "is required by the rabbitmq type")}
+	}
+	if config.RabbitMQConfig.Host == "" {
+		return field.ErrorList{field.Required(path.Child("rabbitmq", "host"), "")}
+	}
+	return nil
+}
+
+func NewRabbitMQClient(rabbitMQConfig *RabbitMQConfig, secretManager secret_manager.SecretManager) (*RabbitMQBroker, error) {
+	password, err := secretManager.Get(rabbitMQConfig.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRabbitMQBroker(rabbitMQConfig, password), nil
+}
+
+func newRabbitMQBroker(config *RabbitMQConfig, password string) *RabbitMQBroker {
+	scheme := "http"
+	if config.UseTLS {
+		scheme = "https"
+	}
+	port := config.Port
+	if port == "" {
+		port = "15672"
+	}
+	vhost := config.VHost
+	if vhost == "" {
+		vhost = "/"
+	}
+
+	return &RabbitMQBroker{
+		client:   &http.Client{Timeout: rabbitMQRequestTimeout},
+		baseURL:  fmt.Sprintf("%s://%s:%s", scheme, config.Host, port),
+		vhost:    vhost,
+		username: config.Username,
+		password: password,
+	}
+}
@@ -0,0 +1,94 @@
+package brokers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRabbitMQTestServer(t *testing.T) (*httptest.Server, *RabbitMQConfig) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/vhosts/{vhost}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("vhost") != "jobs" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"jobs"}`))
+	})
+	mux.HandleFunc("/api/queues/{vhost}/{queue}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("vhost") != "jobs" || r.PathValue("queue") != "tasks/high" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"tasks/high","messages":42,"messages_ready":40,"messages_unacknowledged":2}`))
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "guest" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	host, port, err := net.SplitHostPort(serverURL.Host)
+	require.NoError(t, err)
+
+	return server, &RabbitMQConfig{
+		Host:     host,
+		Port:     port,
+		VHost:    "jobs",
+		Username: "guest",
+		Password: v1alpha1.ValueOrSecret{Value: "secret"},
+	}
+}
+
+func TestRabbitMQBroker_GetQueueLength(t *testing.T) {
+	_, config := newRabbitMQTestServer(t)
+	broker := newRabbitMQBroker(config, "secret")
+	ctx := context.Background()
+
+	length, err := broker.GetQueueLength(&ctx, "tasks/high")
+	require.NoError(t, err)
+	assert.Equal(t, 42, length)
+
+	length, err = broker.GetQueueLength(&ctx, "missing")
+	assert.Error(t, err)
+	assert.Equal(t, -1, length)
+}
+
+func TestRabbitMQBroker_IsConnected(t *testing.T) {
+	_, config := newRabbitMQTestServer(t)
+	ctx := context.Background()
+
+	connected, err := newRabbitMQBroker(config, "secret").IsConnected(&ctx)
+	assert.NoError(t, err)
+	assert.True(t, connected)
+
+	connected, err = newRabbitMQBroker(config, "wrong").IsConnected(&ctx)
+	assert.Error(t, err)
+	assert.False(t, connected)
+
+	config.VHost = "missing"
+	connected, err = newRabbitMQBroker(config, "secret").IsConnected(&ctx)
+	assert.Error(t, err)
+	assert.False(t, connected)
+}
+
+func TestNewRabbitMQBroker_Defaults(t *testing.T) {
+	broker := newRabbitMQBroker(&RabbitMQConfig{Host: "rabbitmq", UseTLS: true}, "")
+
+	assert.Equal(t, "https://rabbitmq:15672", broker.baseURL)
+	assert.Equal(t, "/", broker.vhost)
+}
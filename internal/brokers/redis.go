@@ -3,24 +3,52 @@ package brokers
 import (
 	"context"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 
 	"github.com/go-redis/redis/v8"
-	"github.com/mitchellh/mapstructure"
 	"github.com/quickube/QScaler/api/v1alpha1"
 	"github.com/quickube/QScaler/internal/secret_manager"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var (
+	redisStreamScanCount int64 = 1000
 )
 
 type RedisBroker struct {
-	client *redis.Client
+	client redis.UniversalClient
+	// streams maps the stream queues to the consumer group of their workers
+	streams map[string]string
 }
 
 type RedisConfig struct {
-	Host     string                 `yaml:"host"`
-	Port     string                 `yaml:"port"`
-	Password v1alpha1.ValueOrSecret `yaml:"password"`
+	Host     string                        `yaml:"host"`
+	Port     string                        `yaml:"port"`
+	Username string                        `yaml:"username"`
+	Password v1alpha1.ValueOrSecret        `yaml:"password"`
+	DB       int                           `yaml:"db"`
+	TLS      *v1alpha1.TLSConfig           `yaml:"tls"`
+	Streams  []v1alpha1.RedisStream        `yaml:"streams"`
+	Sentinel *v1alpha1.RedisSentinelConfig `yaml:"sentinel"`
+	Cluster  *v1alpha1.RedisClusterConfig  `yaml:"cluster"`
+}
+
+// redisStreamGroup is the part of an XINFO GROUPS entry the queue length is computed from
+type redisStreamGroup struct {
+	pending         int64
+	lastDeliveredID string
+	// lag is nil when redis cannot tell the number of undelivered entries, e.g. before
+	// 7.0 or after entries were deleted from the stream
+	lag *int64
 }
 
 func (r *RedisBroker) GetQueueLength(ctx *context.Context, topic string) (int, error) {
+	if consumerGroup, ok := r.streams[topic]; ok {
+		return r.getStreamLength(*ctx, topic, consumerGroup)
+	}
+
 	taskQueueLength, err := r.client.LLen(*ctx, topic).Result()
 	if err != nil {
 		return -1, err
@@ -33,29 +61,257 @@ func (r *RedisBroker) IsConnected(ctx *context.Context) (bool, error) {
 	return status.Err() == nil, status.Err()
 }
 
-func NewRedisClient(config *v1alpha1.ScalerConfig) (*RedisBroker, error) {
-	redisConfig := &RedisConfig{}
-	err := mapstructure.Decode(config.Spec.Config.RedisConfig, &redisConfig)
+// Close closes the connection pool of the client
+func (r *RedisBroker) Close() error {
+	return r.client.Close()
+}
+
+// getStreamLength returns the entries of the stream the consumer group has not acknowledged,
+// which are the ones pending on its consumers and the ones not delivered to the group yet
+func (r *RedisBroker) getStreamLength(ctx context.Context, stream string, consumerGroup string) (int, error) {
+	// the key of XINFO follows its subcommand, so cluster clients must be told where it is
+	// to route the command to the shard of the stream
+	cmd := redis.NewCmd(ctx, "XINFO", "GROUPS", stream)
+	cmd.SetFirstKeyPos(2)
+	_ = r.client.Process(ctx, cmd)
+	reply, err := cmd.Result()
+	if err != nil {
+		return -1, err
+	}
+	groups, err := parseRedisStreamGroups(reply)
+	if err != nil {
+		return -1, fmt.Errorf("invalid XINFO GROUPS reply of stream %s: %w", stream, err)
+	}
+	group, ok := groups[consumerGroup]
+	if !ok {
+		return -1, fmt.Errorf("consumer group %s not found on stream %s", consumerGroup, stream)
+	}
+
+	if group.lag != nil {
+		return int(group.pending + *group.lag), nil
+	}
+	undelivered, err := r.countStreamEntriesAfter(ctx, stream, group.lastDeliveredID)
+	if err != nil {
+		return -1, err
+	}
+	return int(group.pending + undelivered), nil
+}
+
+// countStreamEntriesAfter counts the entries of the stream newer than the given id
+func (r *RedisBroker) countStreamEntriesAfter(ctx context.Context, stream string, id string) (int64, error) {
+	var count int64
+	for {
+		start, err := nextRedisStreamID(id)
+		if err != nil {
+			return 0, err
+		}
+		messages, err := r.client.XRangeN(ctx, stream, start, "+", redisStreamScanCount).Result()
+		if err != nil {
+			return 0, err
+		}
+		count += int64(len(messages))
+		if int64(len(messages)) < redisStreamScanCount {
+			return count, nil
+		}
+		id = messages[len(messages)-1].ID
+	}
+}
+
+// nextRedisStreamID returns the smallest stream id greater than the given one, since
+// exclusive XRANGE ranges need redis 6.2
+func nextRedisStreamID(id string) (string, error) {
+	milliseconds, sequence, found := strings.Cut(id, "-")
+	if !found {
+		sequence = "0"
+	}
+	ms, err := strconv.ParseUint(milliseconds, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid stream id %s: %w", id, err)
+	}
+	seq, err := strconv.ParseUint(sequence, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid stream id %s: %w", id, err)
+	}
+
+	if seq == math.MaxUint64 {
+		return fmt.Sprintf("%d-0", ms+1), nil
+	}
+	return fmt.Sprintf("%d-%d", ms, seq+1), nil
+}
+
+// parseRedisStreamGroups parses an XINFO GROUPS reply into the groups of the stream by name
+func parseRedisStreamGroups(reply interface{}) (map[string]redisStreamGroup, error) {
+	entries, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected reply type %T", reply)
+	}
+
+	groups := make(map[string]redisStreamGroup, len(entries))
+	for _, entry := range entries {
+		fields, ok := entry.([]interface{})
+		if !ok || len(fields)%2 != 0 {
+			return nil, fmt.Errorf("unexpected group entry %v", entry)
+		}
+
+		var name string
+		group := redisStreamGroup{}
+		for i := 0; i < len(fields); i += 2 {
+			key, _ := fields[i].(string)
+			value := fields[i+1]
+			switch key {
+			case "name":
+				name, _ = value.(string)
+			case "pending":
+				group.pending, _ = value.(int64)
+			case "last-delivered-id":
+				group.lastDeliveredID, _ = value.(string)
+			case "lag":
+				if lag, ok := value.(int64); ok {
+					group.lag = &lag
+				}
+			}
+		}
+		groups[name] = group
+	}
+	return groups, nil
+}
+
+func init() {
+	RegisterBrokerType("redis", NewTypedBrokerFactory(
+		func(c *v1alpha1.ScalerTypeConfigs) *v1alpha1.RedisConfig { return &c.RedisConfig }, NewRedisClient),
+		validateRedisConfig)
+}
+
+// validateRedisConfig requires a host and a port, unless the Redis nodes are found through Sentinel or Cluster
+func validateRedisConfig(typeConfig *v1alpha1.ScalerTypeConfigs, path *field.Path) field.ErrorList {
+	config := typeConfig.RedisConfig
+	var allErrs field.ErrorList
+
+	switch {
+	case config.Sentinel != nil && config.Cluster != nil:
+		allErrs = append(allErrs, field.Forbidden(path.Child("cluster"), "sentinel and cluster are mutually exclusive"))
+	case config.Sentinel != nil:
+		if config.Sentinel.MasterName == "" {
+			allErrs = append(allErrs, field.Required(path.Child("sentinel", "masterName"), ""))
+		}
+		if len(config.Sentinel.Addresses) == 0 {
+			allErrs = append(allErrs, field.Required(path.Child("sentinel", "addresses"), "at least one sentinel address is required"))
+		}
+	case config.Cluster != nil:
+		if len(config.Cluster.Addresses) == 0 {
+			allErrs = append(allErrs, field.Required(path.Child("cluster", "addresses"), "at least one seed node address is required"))
+		}
+		if config.DB != 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("db"), config.DB, "Redis Cluster only supports database 0"))
+		}
+	default:
+		if config.Host == "" {
+			allErrs = append(allErrs, field.Required(path.Child("host"), ""))
+		}
+		if config.Port == "" {
+			allErrs = append(allErrs, field.Required(path.Child("port"), ""))
+		} else if port, err := strconv.Atoi(config.Port); err != nil || port < 1 || port > 65535 {
+			allErrs = append(allErrs, field.Invalid(path.Child("port"), config.Port, "must be a port number between 1 and 65535"))
+		}
+	}
+
+	if config.DB < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("db"), config.DB, "must not be negative"))
+	}
+	return allErrs
+}
+
+func NewRedisClient(redisConfig *RedisConfig, secretManager secret_manager.SecretManager) (*RedisBroker, error) {
+	options, err := newRedisOptions(secretManager, redisConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	secretManager, err := secret_manager.NewClient()
+	return newRedisBroker(newRedisUniversalClient(redisConfig, options), redisConfig), nil
+}
+
+// newRedisOptions returns the connection options of the config with its passwords and certificates resolved
+func newRedisOptions(secretManager secret_manager.SecretManager, config *RedisConfig) (*redis.UniversalOptions, error) {
+	options, err := redisUniversalOptions(config)
 	if err != nil {
 		return nil, err
 	}
 
-	password, err := secretManager.Get(redisConfig.Password)
+	options.Password, err = secretManager.Get(config.Password)
 	if err != nil {
 		return nil, err
 	}
+	if config.Sentinel != nil {
+		options.SentinelPassword, err = secretManager.Get(config.Sentinel.Password)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.TLS != nil {
+		options.TLSConfig, err = newTLSConfig(secretManager, config.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
 
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", redisConfig.Host, redisConfig.Port),
-		Password: password,
-	})
+// redisUniversalOptions returns the connection options of the topology described by the config
+func redisUniversalOptions(config *RedisConfig) (*redis.UniversalOptions, error) {
+	var options *redis.UniversalOptions
+	switch {
+	case config.Sentinel != nil && config.Cluster != nil:
+		return nil, fmt.Errorf("redis config can not set both sentinel and cluster")
+	case config.Sentinel != nil:
+		if config.Sentinel.MasterName == "" || len(config.Sentinel.Addresses) == 0 {
+			return nil, fmt.Errorf("redis sentinel config requires a master name and sentinel addresses")
+		}
+		options = &redis.UniversalOptions{
+			MasterName: config.Sentinel.MasterName,
+			Addrs:      config.Sentinel.Addresses,
+		}
+	case config.Cluster != nil:
+		if len(config.Cluster.Addresses) == 0 {
+			return nil, fmt.Errorf("redis cluster config requires seed node addresses")
+		}
+		if config.DB != 0 {
+			return nil, fmt.Errorf("redis cluster only supports database 0")
+		}
+		options = &redis.UniversalOptions{
+			Addrs: config.Cluster.Addresses,
+		}
+	default:
+		options = &redis.UniversalOptions{
+			Addrs: []string{fmt.Sprintf("%s:%s", config.Host, config.Port)},
+		}
+	}
+
+	options.Username = config.Username
+	options.DB = config.DB
+	return options, nil
+}
+
+// newRedisUniversalClient builds the client of the configured topology. redis.NewUniversalClient
+// is not used as it would treat a cluster with a single seed node as a standalone redis.
+func newRedisUniversalClient(config *RedisConfig, options *redis.UniversalOptions) redis.UniversalClient {
+	switch {
+	case config.Sentinel != nil:
+		return redis.NewFailoverClient(options.Failover())
+	case config.Cluster != nil:
+		return redis.NewClusterClient(options.Cluster())
+	default:
+		return redis.NewClient(options.Simple())
+	}
+}
+
+func newRedisBroker(client redis.UniversalClient, config *RedisConfig) *RedisBroker {
+	streams := make(map[string]string, len(config.Streams))
+	for _, stream := range config.Streams {
+		streams[stream.Name] = stream.ConsumerGroup
+	}
 
 	return &RedisBroker{
-		client: redisClient,
-	}, nil
+		client:  client,
+		streams: streams,
+	}
 }
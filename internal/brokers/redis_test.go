@@ -0,0 +1,279 @@
+package brokers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedisTestBroker(t *testing.T, streams ...v1alpha1.RedisStream) (*RedisBroker, *redis.Client) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return newRedisBroker(client, &RedisConfig{Streams: streams}), client
+}
+
+func TestRedisBroker_GetQueueLength_List(t *testing.T) {
+	broker, client := newRedisTestBroker(t)
+	ctx := context.Background()
+	require.NoError(t, client.RPush(ctx, "tasks", "a", "b", "c").Err())
+
+	length, err := broker.GetQueueLength(&ctx, "tasks")
+	require.NoError(t, err)
+	assert.Equal(t, 3, length)
+}
+
+func TestRedisBroker_GetQueueLength_Stream(t *testing.T) {
+	broker, client := newRedisTestBroker(t, v1alpha1.RedisStream{Name: "events", ConsumerGroup: "workers"})
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, client.XAdd(ctx, &redis.XAddArgs{Stream: "events", Values: map[string]interface{}{"i": i}}).Err())
+	}
+	require.NoError(t, client.XGroupCreate(ctx, "events", "workers", "0").Err())
+
+	length, err := broker.GetQueueLength(&ctx, "events")
+	require.NoError(t, err)
+	assert.Equal(t, 5, length)
+
+	// queues that are not configured as streams are still read as lists
+	require.NoError(t, client.RPush(ctx, "tasks", "a").Err())
+	length, err = broker.GetQueueLength(&ctx, "tasks")
+	require.NoError(t, err)
+	assert.Equal(t, 1, length)
+}
+
+func TestRedisBroker_GetQueueLength_MissingGroup(t *testing.T) {
+	broker, client := newRedisTestBroker(t, v1alpha1.RedisStream{Name: "events", ConsumerGroup: "workers"})
+	ctx := context.Background()
+	require.NoError(t, client.XAdd(ctx, &redis.XAddArgs{Stream: "events", Values: map[string]interface{}{"i": 0}}).Err())
+	require.NoError(t, client.XGroupCreate(ctx, "events", "others", "0").Err())
+
+	_, err := broker.GetQueueLength(&ctx, "events")
+	assert.ErrorContains(t, err, "consumer group workers not found")
+}
+
+func TestRedisBroker_CountStreamEntriesAfter(t *testing.T) {
+	broker, client := newRedisTestBroker(t)
+	ctx := context.Background()
+	defer func(scanCount int64) { redisStreamScanCount = scanCount }(redisStreamScanCount)
+	redisStreamScanCount = 2
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		id, err := client.XAdd(ctx, &redis.XAddArgs{Stream: "events", Values: map[string]interface{}{"i": i}}).Result()
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	count, err := broker.countStreamEntriesAfter(ctx, "events", "0-0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), count)
+
+	count, err = broker.countStreamEntriesAfter(ctx, "events", ids[1])
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	count, err = broker.countStreamEntriesAfter(ctx, "events", ids[4])
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestNextRedisStreamID(t *testing.T) {
+	tests := []struct {
+		id       string
+		expected string
+	}{
+		{id: "0-0", expected: "0-1"},
+		{id: "1700000000000-5", expected: "1700000000000-6"},
+		{id: "1700000000000", expected: "1700000000000-1"},
+		{id: "5-18446744073709551615", expected: "6-0"},
+	}
+	for _, tt := range tests {
+		next, err := nextRedisStreamID(tt.id)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, next)
+	}
+
+	_, err := nextRedisStreamID("invalid")
+	assert.Error(t, err)
+}
+
+func TestParseRedisStreamGroups(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{
+			"name", "workers",
+			"consumers", int64(2),
+			"pending", int64(3),
+			"last-delivered-id", "1700000000000-4",
+			"entries-read", int64(5),
+			"lag", int64(7),
+		},
+		// redis 7 replies with a nil lag when it cannot be computed, older versions omit it
+		[]interface{}{
+			"name", "others",
+			"consumers", int64(0),
+			"pending", int64(1),
+			"last-delivered-id", "1700000000000-0",
+			"entries-read", nil,
+			"lag", nil,
+		},
+	}
+
+	groups, err := parseRedisStreamGroups(reply)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+
+	assert.Equal(t, int64(3), groups["workers"].pending)
+	assert.Equal(t, "1700000000000-4", groups["workers"].lastDeliveredID)
+	require.NotNil(t, groups["workers"].lag)
+	assert.Equal(t, int64(7), *groups["workers"].lag)
+
+	assert.Equal(t, int64(1), groups["others"].pending)
+	assert.Nil(t, groups["others"].lag)
+
+	_, err = parseRedisStreamGroups("OK")
+	assert.Error(t, err)
+}
+
+func TestRedisUniversalOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *RedisConfig
+		masterName string
+		addrs      []string
+		wantErr    bool
+	}{
+		{
+			name:   "standalone",
+			config: &RedisConfig{Host: "redis", Port: "6379"},
+			addrs:  []string{"redis:6379"},
+		},
+		{
+			name: "sentinel",
+			config: &RedisConfig{Sentinel: &v1alpha1.RedisSentinelConfig{
+				MasterName: "mymaster",
+				Addresses:  []string{"sentinel-0:26379", "sentinel-1:26379"},
+			}},
+			masterName: "mymaster",
+			addrs:      []string{"sentinel-0:26379", "sentinel-1:26379"},
+		},
+		{
+			name:    "sentinel without master name",
+			config:  &RedisConfig{Sentinel: &v1alpha1.RedisSentinelConfig{Addresses: []string{"sentinel-0:26379"}}},
+			wantErr: true,
+		},
+		{
+			name:   "cluster",
+			config: &RedisConfig{Cluster: &v1alpha1.RedisClusterConfig{Addresses: []string{"redis-0:6379"}}},
+			addrs:  []string{"redis-0:6379"},
+		},
+		{
+			name:    "cluster with a database",
+			config:  &RedisConfig{DB: 1, Cluster: &v1alpha1.RedisClusterConfig{Addresses: []string{"redis-0:6379"}}},
+			wantErr: true,
+		},
+		{
+			name:    "cluster without seed nodes",
+			config:  &RedisConfig{Cluster: &v1alpha1.RedisClusterConfig{}},
+			wantErr: true,
+		},
+		{
+			name: "sentinel and cluster",
+			config: &RedisConfig{
+				Sentinel: &v1alpha1.RedisSentinelConfig{MasterName: "mymaster", Addresses: []string{"sentinel-0:26379"}},
+				Cluster:  &v1alpha1.RedisClusterConfig{Addresses: []string{"redis-0:6379"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := redisUniversalOptions(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.masterName, options.MasterName)
+			assert.Equal(t, tt.addrs, options.Addrs)
+		})
+	}
+}
+
+func TestRedisBroker_Cluster(t *testing.T) {
+	server := miniredis.RunT(t)
+	config := &RedisConfig{
+		Cluster: &v1alpha1.RedisClusterConfig{Addresses: []string{server.Addr()}},
+		Streams: []v1alpha1.RedisStream{{Name: "events", ConsumerGroup: "workers"}},
+	}
+	options, err := redisUniversalOptions(config)
+	require.NoError(t, err)
+	client := newRedisUniversalClient(config, options)
+	t.Cleanup(func() { _ = client.Close() })
+	require.IsType(t, &redis.ClusterClient{}, client)
+
+	broker := newRedisBroker(client, config)
+	ctx := context.Background()
+	require.NoError(t, client.RPush(ctx, "tasks", "a", "b").Err())
+	require.NoError(t, client.XAdd(ctx, &redis.XAddArgs{Stream: "events", Values: map[string]interface{}{"i": 0}}).Err())
+	require.NoError(t, client.XGroupCreate(ctx, "events", "workers", "0").Err())
+
+	length, err := broker.GetQueueLength(&ctx, "tasks")
+	require.NoError(t, err)
+	assert.Equal(t, 2, length)
+
+	length, err = broker.GetQueueLength(&ctx, "events")
+	require.NoError(t, err)
+	assert.Equal(t, 1, length)
+
+	connected, err := broker.IsConnected(&ctx)
+	require.NoError(t, err)
+	assert.True(t, connected)
+}
+
+func TestRedisBroker_TLSAndACL(t *testing.T) {
+	certificates := newTestCertificates(t)
+	server, err := miniredis.RunTLS(certificates.serverTLSConfig(t))
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+	server.RequireUserAuth("qscaler", "secret")
+	_, err = server.DB(3).Lpush("tasks", "a")
+	require.NoError(t, err)
+
+	config := &RedisConfig{
+		Host:     server.Host(),
+		Port:     server.Port(),
+		Username: "qscaler",
+		Password: v1alpha1.ValueOrSecret{Value: "secret"},
+		DB:       3,
+		TLS:      &v1alpha1.TLSConfig{CA: v1alpha1.ValueOrSecret{Value: certificates.ca}},
+	}
+	options, err := newRedisOptions(newValueSecretManager(t), config)
+	require.NoError(t, err)
+	client := newRedisUniversalClient(config, options)
+	t.Cleanup(func() { _ = client.Close() })
+
+	broker := newRedisBroker(client, config)
+	ctx := context.Background()
+	connected, err := broker.IsConnected(&ctx)
+	require.NoError(t, err)
+	assert.True(t, connected)
+
+	length, err := broker.GetQueueLength(&ctx, "tasks")
+	require.NoError(t, err)
+	assert.Equal(t, 1, length)
+
+	// the server certificate is not trusted without the ca
+	config.TLS = &v1alpha1.TLSConfig{}
+	options, err = newRedisOptions(newValueSecretManager(t), config)
+	require.NoError(t, err)
+	untrustedClient := newRedisUniversalClient(config, options)
+	t.Cleanup(func() { _ = untrustedClient.Close() })
+	assert.Error(t, untrustedClient.Ping(ctx).Err())
+}
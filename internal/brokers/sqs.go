@@ -0,0 +1,165 @@
+package brokers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/quickube/QScaler/internal/secret_manager"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// SQSBroker reads approximate queue depths from Amazon SQS
+type SQSBroker struct {
+	client          *sqs.Client
+	includeInFlight bool
+
+	queueURLsMutex sync.Mutex
+	queueURLs      map[string]string
+}
+
+type SQSConfig struct {
+	Region          string                 `yaml:"region"`
+	Endpoint        string                 `yaml:"endpoint"`
+	AccessKeyID     v1alpha1.ValueOrSecret `yaml:"accessKeyId"`
+	SecretAccessKey v1alpha1.ValueOrSecret `yaml:"secretAccessKey"`
+	SessionToken    v1alpha1.ValueOrSecret `yaml:"sessionToken"`
+	IncludeInFlight bool                   `yaml:"includeInFlight"`
+}
+
+// GetQueueLength returns the approximate number of visible messages of the queue, and of the in-flight
+// ones if configured to. The topic can be either a queue URL or a queue name.
+func (s *SQSBroker) GetQueueLength(ctx *context.Context, topic string) (int, error) {
+	queueURL, err := s.queueURL(*ctx, topic)
+	if err != nil {
+		return -1, err
+	}
+
+	attributeNames := []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameApproximateNumberOfMessages}
+	if s.includeInFlight {
+		attributeNames = append(attributeNames, sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible)
+	}
+	output, err := s.client.GetQueueAttributes(*ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: attributeNames,
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	queueLength := 0
+	for _, attributeName := range attributeNames {
+		value, err := strconv.Atoi(output.Attributes[string(attributeName)])
+		if err != nil {
+			return -1, fmt.Errorf("invalid %s attribute of queue %s: %w", attributeName, queueURL, err)
+		}
+		queueLength += value
+	}
+	return queueLength, nil
+}
+
+func (s *SQSBroker) IsConnected(ctx *context.Context) (bool, error) {
+	_, err := s.client.ListQueues(*ctx, &sqs.ListQueuesInput{MaxResults: aws.Int32(1)})
+	return err == nil, err
+}
+
+// Close does nothing, since the SQS client keeps no connection open
+func (s *SQSBroker) Close() error {
+	return nil
+}
+
+func (s *SQSBroker) queueURL(ctx context.Context, topic string) (string, error) {
+	if strings.HasPrefix(topic, "https://") || strings.HasPrefix(topic, "http://") {
+		return topic, nil
+	}
+
+	s.queueURLsMutex.Lock()
+	queueURL, ok := s.queueURLs[topic]
+	s.queueURLsMutex.Unlock()
+	if ok {
+		return queueURL, nil
+	}
+
+	// the lookup is not locked, so a slow one does not hold up the polls of other queues
+	output, err := s.client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(topic)})
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve url of queue %s: %w", topic, err)
+	}
+
+	s.queueURLsMutex.Lock()
+	defer s.queueURLsMutex.Unlock()
+	// keep the url of a concurrent lookup that finished first
+	if queueURL, ok = s.queueURLs[topic]; !ok {
+		queueURL = aws.ToString(output.QueueUrl)
+		s.queueURLs[topic] = queueURL
+	}
+	return queueURL, nil
+}
+
+func init() {
+	RegisterBrokerType("sqs", NewTypedBrokerFactory(
+		func(c *v1alpha1.ScalerTypeConfigs) *v1alpha1.SQSConfig { return c.SQSConfig }, NewSQSClient),
+		validateSQSConfig)
+}
+
+// validateSQSConfig requires the region of the queues
+func validateSQSConfig(config *v1alpha1.ScalerTypeConfigs, path *field.Path) field.ErrorList {
+	if config.SQSConfig == nil {
+		return field.ErrorList{field.Required(path.Child("sqs"), "is required by the sqs type")}
+	}
+	if config.SQSConfig.Region == "" {
+		return field.ErrorList{field.Required(path.Child("sqs", "region"), "")}
+	}
+	return nil
+}
+
+func NewSQSClient(sqsConfig *SQSConfig, secretManager secret_manager.SecretManager) (*SQSBroker, error) {
+	var awsConfig aws.Config
+	accessKeyID, err := secretManager.Get(sqsConfig.AccessKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if accessKeyID != "" {
+		secretAccessKey, err := secretManager.Get(sqsConfig.SecretAccessKey)
+		if err != nil {
+			return nil, err
+		}
+		sessionToken, err := secretManager.Get(sqsConfig.SessionToken)
+		if err != nil {
+			return nil, err
+		}
+		awsConfig = aws.Config{
+			Region:      sqsConfig.Region,
+			Credentials: credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, sessionToken),
+		}
+	} else {
+		awsConfig, err = awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(sqsConfig.Region))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load default AWS config: %w", err)
+		}
+	}
+
+	return newSQSBroker(awsConfig, sqsConfig), nil
+}
+
+func newSQSBroker(awsConfig aws.Config, config *SQSConfig) *SQSBroker {
+	client := sqs.NewFromConfig(awsConfig, func(o *sqs.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.Endpoint)
+		}
+	})
+
+	return &SQSBroker{
+		client:          client,
+		includeInFlight: config.IncludeInFlight,
+		queueURLs:       make(map[string]string),
+	}
+}
@@ -0,0 +1,138 @@
+package brokers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSQSTestServer serves the SQS JSON protocol for a single queue. lookupHook, when set, is called with the
+// name of every queue whose url is looked up.
+func newSQSTestServer(t *testing.T, lookupHook func(queueName string)) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		queueURL := server.URL + "/000000000000/tasks"
+		switch r.Header.Get("X-Amz-Target") {
+		case "AmazonSQS.ListQueues":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"QueueUrls": []string{queueURL}})
+		case "AmazonSQS.GetQueueUrl":
+			if lookupHook != nil {
+				lookupHook(input["QueueName"].(string))
+			}
+			if input["QueueName"] != "tasks" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"com.amazonaws.sqs#QueueDoesNotExist","message":"queue does not exist"}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"QueueUrl": queueURL})
+		case "AmazonSQS.GetQueueAttributes":
+			if input["QueueUrl"] != queueURL {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"com.amazonaws.sqs#QueueDoesNotExist","message":"queue does not exist"}`))
+				return
+			}
+			attributes := map[string]string{}
+			for _, name := range input["AttributeNames"].([]interface{}) {
+				switch name {
+				case "ApproximateNumberOfMessages":
+					attributes["ApproximateNumberOfMessages"] = "7"
+				case "ApproximateNumberOfMessagesNotVisible":
+					attributes["ApproximateNumberOfMessagesNotVisible"] = "3"
+				}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"Attributes": attributes})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestSQSBroker(endpoint string, includeInFlight bool) *SQSBroker {
+	awsConfig := aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("test", "test", ""),
+	}
+	return newSQSBroker(awsConfig, &SQSConfig{Endpoint: endpoint, IncludeInFlight: includeInFlight})
+}
+
+func TestSQSBroker_GetQueueLength(t *testing.T) {
+	server := newSQSTestServer(t, nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name            string
+		queue           string
+		includeInFlight bool
+		expected        int
+		expectedError   bool
+	}{
+		{name: "Visible messages by queue url", queue: server.URL + "/000000000000/tasks", expected: 7},
+		{name: "Visible messages by queue name", queue: "tasks", expected: 7},
+		{name: "Including in-flight messages", queue: "tasks", includeInFlight: true, expected: 10},
+		{name: "Unknown queue", queue: "missing", expected: -1, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newTestSQSBroker(server.URL, tt.includeInFlight)
+
+			length, err := broker.GetQueueLength(&ctx, tt.queue)
+			assert.Equal(t, tt.expectedError, err != nil, "unexpected error: %v", err)
+			assert.Equal(t, tt.expected, length)
+		})
+	}
+}
+
+func TestSQSBroker_IsConnected(t *testing.T) {
+	server := newSQSTestServer(t, nil)
+	ctx := context.Background()
+
+	connected, err := newTestSQSBroker(server.URL, false).IsConnected(&ctx)
+	require.NoError(t, err)
+	assert.True(t, connected)
+}
+
+func TestSQSBroker_SlowQueueURLLookup(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	server := newSQSTestServer(t, func(queueName string) {
+		if queueName == "slow" {
+			close(started)
+			<-release
+		}
+	})
+	defer close(release)
+	ctx := context.Background()
+	broker := newTestSQSBroker(server.URL, false)
+
+	go func() { _, _ = broker.GetQueueLength(&ctx, "slow") }()
+	<-started
+
+	done := make(chan int)
+	go func() {
+		length, _ := broker.GetQueueLength(&ctx, "tasks")
+		done <- length
+	}()
+	select {
+	case length := <-done:
+		assert.Equal(t, 7, length)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lookup of a slow queue url blocked the poll of another queue")
+	}
+}
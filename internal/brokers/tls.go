@@ -0,0 +1,48 @@
+package brokers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/quickube/QScaler/internal/secret_manager"
+)
+
+// newTLSConfig builds a client TLS configuration, resolving its certificates through the secret manager
+func newTLSConfig(secretManager secret_manager.SecretManager, config *v1alpha1.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	ca, err := secretManager.Get(config.CA)
+	if err != nil {
+		return nil, err
+	}
+	if ca != "" {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM([]byte(ca)) {
+			return nil, fmt.Errorf("no valid certificates found in tls ca")
+		}
+	}
+
+	cert, err := secretManager.Get(config.Cert)
+	if err != nil {
+		return nil, err
+	}
+	key, err := secretManager.Get(config.Key)
+	if err != nil {
+		return nil, err
+	}
+	if cert != "" || key != "" {
+		certificate, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,114 @@
+package brokers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/quickube/QScaler/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificates are a certificate authority and a localhost server certificate signed by it, PEM encoded
+type testCertificates struct {
+	ca         string
+	serverCert string
+	serverKey  string
+}
+
+func newTestCertificates(t *testing.T) testCertificates {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "qscaler-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serverTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caTemplate, &serverKey.PublicKey, caKey)
+	require.NoError(t, err)
+	serverKeyDER, err := x509.MarshalECPrivateKey(serverKey)
+	require.NoError(t, err)
+
+	return testCertificates{
+		ca:         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})),
+		serverCert: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverDER})),
+		serverKey:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: serverKeyDER})),
+	}
+}
+
+// serverTLSConfig returns a server configuration presenting the server certificate
+func (c testCertificates) serverTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	certificate, err := tls.X509KeyPair([]byte(c.serverCert), []byte(c.serverKey))
+	require.NoError(t, err)
+	return &tls.Config{Certificates: []tls.Certificate{certificate}}
+}
+
+// newValueSecretManager returns a secret manager mock resolving every secret to its value
+func newValueSecretManager(t *testing.T) *mocks.SecretManager {
+	secretManager := mocks.NewSecretManager(t)
+	secretManager.On("Get", mock.Anything).Return(func(secret v1alpha1.ValueOrSecret) (string, error) {
+		return secret.Value, nil
+	}).Maybe()
+	return secretManager
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	certificates := newTestCertificates(t)
+	secretManager := newValueSecretManager(t)
+
+	tlsConfig, err := newTLSConfig(secretManager, &v1alpha1.TLSConfig{
+		CA:         v1alpha1.ValueOrSecret{Value: certificates.ca},
+		Cert:       v1alpha1.ValueOrSecret{Value: certificates.serverCert},
+		Key:        v1alpha1.ValueOrSecret{Value: certificates.serverKey},
+		ServerName: "localhost",
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.Equal(t, "localhost", tlsConfig.ServerName)
+
+	tlsConfig, err = newTLSConfig(secretManager, &v1alpha1.TLSConfig{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig.RootCAs, "the system certificate authorities are used without a ca")
+	assert.Empty(t, tlsConfig.Certificates)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+
+	_, err = newTLSConfig(secretManager, &v1alpha1.TLSConfig{CA: v1alpha1.ValueOrSecret{Value: "not a certificate"}})
+	assert.Error(t, err)
+
+	_, err = newTLSConfig(secretManager, &v1alpha1.TLSConfig{Cert: v1alpha1.ValueOrSecret{Value: certificates.serverCert}})
+	assert.Error(t, err, "a client certificate requires its key")
+}
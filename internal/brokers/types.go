@@ -5,4 +5,12 @@ import "context"
 type Broker interface {
 	GetQueueLength(ctx *context.Context, topic string) (int, error)
 	IsConnected(ctx *context.Context) (bool, error)
+	// Close releases the connections of the broker once its ScalerConfig is gone
+	Close() error
+}
+
+// ConsumerLimitedBroker is implemented by brokers that can only spread a queue over a limited number of consumers
+type ConsumerLimitedBroker interface {
+	// GetMaxConsumers returns how many workers can consume the topic at once, or 0 if there is no limit
+	GetMaxConsumers(ctx *context.Context, topic string) (int, error)
 }
@@ -19,12 +19,15 @@ package controller
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/quickube/QScaler/internal/metrics"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -42,7 +45,7 @@ type QWorkerReconciler struct {
 // +kubebuilder:rbac:groups=quickube.com,resources=qworkers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=quickube.com,resources=qworkers/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=quickube.com,resources=qworkers/finalizers,verbs=update
-// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 // +kubebuilder:rbac:groups="metrics.k8s.io",resources=pods,verbs=get;list;watch
 
@@ -51,6 +54,7 @@ func (r *QWorkerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	qworker := &v1alpha1.QWorker{}
 	if err := r.Get(ctx, req.NamespacedName, qworker); err != nil {
 		if errors.IsNotFound(err) {
+			metrics.DeleteQWorkerMetrics(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		log.Log.Error(err, "unable to fetch QWorker")
@@ -61,8 +65,11 @@ func (r *QWorkerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	if err := r.List(ctx, &podList, client.InNamespace(req.Namespace), client.MatchingFields{"metadata.ownerReferences.name": qworker.Name}); err != nil {
 		return ctrl.Result{}, err
 	}
-	currentPodCount := len(podList.Items)
-	qworker.Status.CurrentReplicas = currentPodCount
+	activePods, drainingPods, finishedPods := splitPods(podList.Items)
+	// workers that exit on their own are replaced, so their pods are removed rather than left behind
+	if err := r.deleteFinishedWorkers(&ctx, finishedPods); err != nil {
+		return ctrl.Result{}, err
+	}
 
 	// Generate the hash for the pod template
 	podSpecHash, err := GeneratePodSpecHash(qworker.Spec.PodSpec)
@@ -71,13 +78,29 @@ func (r *QWorkerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	}
 
 	qworker.Status.CurrentPodSpecHash = podSpecHash
+	qworker.Status.Selector = labels.SelectorFromSet(workerLabels(qworker)).String()
+	updatedPods, outdatedPods := splitPodsBySpecHash(activePods, podSpecHash)
+	qworker.Status.CurrentReplicas = len(activePods)
+	qworker.Status.DrainingReplicas = len(drainingPods)
+	qworker.Status.UpdatedReplicas = len(updatedPods)
+	qworker.Status.OutdatedReplicas = len(outdatedPods)
 
 	if err = r.Status().Update(ctx, qworker); err != nil {
 		log.Log.Error(err, fmt.Sprintf("Failed to update QWorker status %s", qworker.Name))
 		return ctrl.Result{}, err
 	}
 
+	rollingUpdate := qworker.Spec.RolloutStrategy.Type != v1alpha1.OnDeleteRolloutStrategyType && len(outdatedPods) > 0
+	maxSurge, maxUnavailable, err := rolloutBudget(qworker.Spec.RolloutStrategy, qworker.Status.DesiredReplicas)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	diffAmount := qworker.Status.DesiredReplicas - qworker.Status.CurrentReplicas
+	if rollingUpdate && diffAmount < 0 {
+		// surge workers are replacing outdated ones, leave them for the rollout to drain
+		diffAmount = min(0, diffAmount+maxSurge)
+	}
 
 	if diffAmount > 0 {
 		log.Log.Info(fmt.Sprintf("scaling horizontally %s from %d to %d", qworker.Name, qworker.Status.CurrentReplicas, qworker.Status.DesiredReplicas))
@@ -87,13 +110,140 @@ func (r *QWorkerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 			}
 		}
 
+	} else if diffAmount < 0 {
+		log.Log.Info(fmt.Sprintf("draining %s from %d to %d", qworker.Name, qworker.Status.CurrentReplicas, qworker.Status.DesiredReplicas))
+		// outdated workers are the first to go
+		sortPodsForDrain(outdatedPods)
+		sortPodsForDrain(updatedPods)
+		surplusPods := append(append([]corev1.Pod{}, outdatedPods...), updatedPods...)
+		for i := range -diffAmount {
+			if err = r.DrainWorker(&ctx, qworker, &surplusPods[i]); err != nil {
+				return ctrl.Result{}, err
+			}
+			drainingPods = append(drainingPods, surplusPods[i])
+		}
+		updatedPods = surplusPods[max(-diffAmount, len(outdatedPods)):]
+		outdatedPods = surplusPods[min(-diffAmount, len(outdatedPods)):len(outdatedPods)]
+	}
+
+	if rollingUpdate && len(outdatedPods) > 0 {
+		var drainedPods []corev1.Pod
+		drainedPods, err = r.rollOut(&ctx, qworker, outdatedPods, countReadyPods(updatedPods)+countReadyPods(outdatedPods), maxSurge, maxUnavailable)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		drainingPods = append(drainingPods, drainedPods...)
 	}
 
+	requeueAfter, err := r.deleteDrainedWorkers(&ctx, qworker, drainingPods)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	qworker.SetCondition(v1alpha1.PodCreationFailedCondition, metav1.ConditionFalse, "NoFailures",
+		"no worker pod failed to be created")
 	log.Log.Info(fmt.Sprintf("Qworker %s replica count is %d", qworker.Name, qworker.Status.CurrentReplicas))
 	if err = r.Status().Update(ctx, qworker); err != nil {
 		return ctrl.Result{}, err
 	}
-	return ctrl.Result{}, nil
+	metrics.RecordCurrentReplicas(qworker)
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// rollOut replaces outdated workers with workers running the current pod spec. New workers are surged
+// up to maxSurge above the desired replicas, and outdated workers are drained as long as no more than
+// maxUnavailable of the desired replicas are unavailable. It returns the pods it started draining.
+func (r *QWorkerReconciler) rollOut(ctx *context.Context, qWorker *v1alpha1.QWorker, outdatedPods []corev1.Pod, availableReplicas, maxSurge, maxUnavailable int) ([]corev1.Pod, error) {
+	log.Log.Info(fmt.Sprintf("rolling out %s, %d outdated workers left", qWorker.Name, len(outdatedPods)))
+
+	surgeAmount := min(len(outdatedPods), qWorker.Status.DesiredReplicas+maxSurge-qWorker.Status.CurrentReplicas)
+	for range surgeAmount {
+		if err := r.StartWorker(ctx, qWorker); err != nil {
+			return nil, err
+		}
+	}
+
+	// outdated workers that are not ready can always be drained, ready ones only within the availability budget
+	drainBudget := availableReplicas - (qWorker.Status.DesiredReplicas - maxUnavailable)
+	sortPodsForDrain(outdatedPods)
+	var drainedPods []corev1.Pod
+	for i := range outdatedPods {
+		if isPodReady(&outdatedPods[i]) {
+			if drainBudget <= 0 {
+				break
+			}
+			drainBudget--
+		}
+		if err := r.DrainWorker(ctx, qWorker, &outdatedPods[i]); err != nil {
+			return nil, err
+		}
+		drainedPods = append(drainedPods, outdatedPods[i])
+	}
+	return drainedPods, nil
+}
+
+// DrainWorker marks a worker pod for scale-down, giving it until the grace deadline to finish its work
+func (r *QWorkerReconciler) DrainWorker(ctx *context.Context, qWorker *v1alpha1.QWorker, pod *corev1.Pod) error {
+	deadline := time.Now().Add(time.Duration(qWorker.Spec.ScaleConfig.ScaleDownGracePeriodSeconds) * time.Second)
+	log.Log.Info("Draining worker", "name", pod.Name, "deadline", deadline.Format(time.RFC3339))
+
+	patch := client.MergeFrom(pod.DeepCopy())
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[v1alpha1.DrainDeadlineAnnotation] = deadline.UTC().Format(time.RFC3339)
+	if err := r.Patch(*ctx, pod, patch); err != nil {
+		log.Log.Error(err, "unable to drain worker pod", "name", pod.Name)
+		return err
+	}
+	metrics.RecordPodDrained(qWorker)
+	qWorker.Status.CurrentReplicas -= 1
+	qWorker.Status.DrainingReplicas += 1
+	if podSpecHash(pod) == qWorker.Status.CurrentPodSpecHash {
+		qWorker.Status.UpdatedReplicas -= 1
+	} else {
+		qWorker.Status.OutdatedReplicas -= 1
+	}
+	return nil
+}
+
+// deleteDrainedWorkers deletes draining pods that acknowledged the drain, exited, or ran out of time.
+// It returns how long to wait until the next pending deadline, or zero if there is none.
+func (r *QWorkerReconciler) deleteDrainedWorkers(ctx *context.Context, qWorker *v1alpha1.QWorker, pods []corev1.Pod) (time.Duration, error) {
+	var requeueAfter time.Duration
+	now := time.Now()
+
+	for i := range pods {
+		pod := &pods[i]
+		deadline, _ := drainDeadline(pod)
+		if !isDrainAcknowledged(pod) && !isPodFinished(pod) && now.Before(deadline) {
+			if remaining := deadline.Sub(now); requeueAfter == 0 || remaining < requeueAfter {
+				requeueAfter = remaining
+			}
+			continue
+		}
+
+		log.Log.Info("Deleting drained worker", "name", pod.Name, "acknowledged", isDrainAcknowledged(pod))
+		if err := r.Delete(*ctx, pod); client.IgnoreNotFound(err) != nil {
+			log.Log.Error(err, "unable to delete drained worker pod", "name", pod.Name)
+			return 0, err
+		}
+		qWorker.Status.DrainingReplicas -= 1
+	}
+	return requeueAfter, nil
+}
+
+// deleteFinishedWorkers deletes worker pods that terminated without being drained
+func (r *QWorkerReconciler) deleteFinishedWorkers(ctx *context.Context, pods []corev1.Pod) error {
+	for i := range pods {
+		pod := &pods[i]
+		log.Log.Info("Deleting finished worker", "name", pod.Name, "phase", pod.Status.Phase)
+		if err := r.Delete(*ctx, pod); client.IgnoreNotFound(err) != nil {
+			log.Log.Error(err, "unable to delete finished worker pod", "name", pod.Name)
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *QWorkerReconciler) StartWorker(ctx *context.Context, qWorker *v1alpha1.QWorker) error {
@@ -104,6 +254,10 @@ func (r *QWorkerReconciler) StartWorker(ctx *context.Context, qWorker *v1alpha1.
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      podId,
 			Namespace: qWorker.ObjectMeta.Namespace,
+			Labels:    workerLabels(qWorker),
+			Annotations: map[string]string{
+				v1alpha1.PodSpecHashAnnotation: qWorker.Status.CurrentPodSpecHash,
+			},
 		},
 		Spec: qWorker.Spec.PodSpec,
 	}
@@ -138,9 +292,15 @@ func (r *QWorkerReconciler) StartWorker(ctx *context.Context, qWorker *v1alpha1.
 
 	if err := r.Create(*ctx, workerPod); err != nil {
 		log.Log.Error(err, "unable to start worker pod")
+		qWorker.SetCondition(v1alpha1.PodCreationFailedCondition, metav1.ConditionTrue, "FailedCreate", err.Error())
+		if updateErr := r.Status().Update(*ctx, qWorker); updateErr != nil {
+			log.Log.Error(updateErr, fmt.Sprintf("Failed to update QWorker status %s", qWorker.Name))
+		}
 		return err
 	}
+	metrics.RecordPodCreated(qWorker)
 	qWorker.Status.CurrentReplicas += 1
+	qWorker.Status.UpdatedReplicas += 1
 	return nil
 }
 
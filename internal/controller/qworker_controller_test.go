@@ -17,8 +17,11 @@ limitations under the License.
 package controller
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"sync/atomic"
+	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -29,7 +32,13 @@ import (
 	"github.com/stretchr/testify/mock"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 var _ = Describe("QWorker Controller", func() {
@@ -48,6 +57,9 @@ var _ = Describe("QWorker Controller", func() {
 			// Mock Broker
 			brokerMock := &mocks.Broker{}
 			brokers.BrokerRegistry[configKey] = brokerMock
+			brokers.RegisterBrokerType(configKey, func(*v1alpha1.ScalerConfig) (brokers.Broker, error) { return brokerMock, nil }, nil)
+			DeferCleanup(brokers.UnregisterBrokerType, configKey)
+			brokerMock.On("Close").Return(nil).Maybe()
 			brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(5, nil)
 			brokerMock.On("IsConnected", mock.Anything).Return(true, nil)
 
@@ -84,7 +96,7 @@ var _ = Describe("QWorker Controller", func() {
 						Queue:           "test-queue",
 						MinReplicas:     1,
 						MaxReplicas:     5,
-						ScalingFactor:   1,
+						ScalingFactor:   ptr.To(1),
 					},
 				},
 				Status: v1alpha1.QWorkerStatus{},
@@ -117,6 +129,9 @@ var _ = Describe("QWorker Controller", func() {
 			// Mock Broker
 			brokerMock := &mocks.Broker{}
 			brokers.BrokerRegistry[configKey] = brokerMock
+			brokers.RegisterBrokerType(configKey, func(*v1alpha1.ScalerConfig) (brokers.Broker, error) { return brokerMock, nil }, nil)
+			DeferCleanup(brokers.UnregisterBrokerType, configKey)
+			brokerMock.On("Close").Return(nil).Maybe()
 			brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(5, nil)
 			brokerMock.On("IsConnected", mock.Anything).Return(true, nil)
 
@@ -152,7 +167,7 @@ var _ = Describe("QWorker Controller", func() {
 						Queue:           "test-queue",
 						MinReplicas:     1,
 						MaxReplicas:     5,
-						ScalingFactor:   1,
+						ScalingFactor:   ptr.To(1),
 					},
 				},
 				Status: v1alpha1.QWorkerStatus{},
@@ -207,6 +222,9 @@ var _ = Describe("QWorker Controller", func() {
 			// Mock Broker
 			brokerMock := &mocks.Broker{}
 			brokers.BrokerRegistry[configKey] = brokerMock
+			brokers.RegisterBrokerType(configKey, func(*v1alpha1.ScalerConfig) (brokers.Broker, error) { return brokerMock, nil }, nil)
+			DeferCleanup(brokers.UnregisterBrokerType, configKey)
+			brokerMock.On("Close").Return(nil).Maybe()
 			brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(3, nil)
 			brokerMock.On("IsConnected", mock.Anything).Return(true, nil)
 
@@ -243,7 +261,7 @@ var _ = Describe("QWorker Controller", func() {
 						Queue:           "test-queue",
 						MinReplicas:     1,
 						MaxReplicas:     3,
-						ScalingFactor:   1,
+						ScalingFactor:   ptr.To(1),
 					},
 				},
 				Status: v1alpha1.QWorkerStatus{},
@@ -261,6 +279,7 @@ var _ = Describe("QWorker Controller", func() {
 			// Verify the pod was created with correct environment variables
 			for _, pod := range podList.Items {
 				if strings.Contains(pod.Name, testID) {
+					Expect(pod.Labels).To(HaveKeyWithValue(v1alpha1.QWorkerLabel, resourceName))
 					for _, env := range pod.Spec.Containers[0].Env {
 						if env.Name == "QWORKER_NAME" {
 							Expect(env.Value).To(Equal(resourceName))
@@ -277,5 +296,260 @@ var _ = Describe("QWorker Controller", func() {
 			Expect(k8sClient.Delete(ctx, scalerConfigResource)).To(Succeed())
 		})
 
+		It("should drain surplus pods when scaling down", func() {
+			// Unique test identifiers
+			testID := fmt.Sprintf("test-%d", time.Now().UnixNano())
+			resourceName := fmt.Sprintf("qworker-%s", testID)
+			scalerConfigName := fmt.Sprintf("scalerconfig-%s", testID)
+			configKey := fmt.Sprintf("%s/%s", namespace, scalerConfigName)
+
+			// Mock Broker with a queue that drains during the test
+			var queueLength atomic.Int64
+			queueLength.Store(3)
+			brokerMock := &mocks.Broker{}
+			brokers.BrokerRegistry[configKey] = brokerMock
+			brokers.RegisterBrokerType(configKey, func(*v1alpha1.ScalerConfig) (brokers.Broker, error) { return brokerMock, nil }, nil)
+			DeferCleanup(brokers.UnregisterBrokerType, configKey)
+			brokerMock.On("Close").Return(nil).Maybe()
+			brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(
+				func(*context.Context, string) int { return int(queueLength.Load()) }, nil)
+			brokerMock.On("IsConnected", mock.Anything).Return(true, nil)
+
+			// Create ScalerConfig resource
+			scalerConfigResource := &v1alpha1.ScalerConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      scalerConfigName,
+					Namespace: namespace,
+				},
+				Spec: v1alpha1.ScalerConfigSpec{
+					Type:   configKey,
+					Config: v1alpha1.ScalerTypeConfigs{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, scalerConfigResource)).To(Succeed())
+
+			// Create QWorker resource
+			qworkerResource := &v1alpha1.QWorker{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: namespace,
+				},
+				Spec: v1alpha1.QWorkerSpec{
+					PodSpec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:  "worker-container",
+								Image: "busybox",
+							},
+						},
+					},
+					ScaleConfig: v1alpha1.QWorkerScaleConfig{
+						ScalerConfigRef:             scalerConfigName,
+						Queue:                       "test-queue",
+						MinReplicas:                 1,
+						MaxReplicas:                 3,
+						ScalingFactor:               ptr.To(1),
+						ScaleDownGracePeriodSeconds: 3600,
+					},
+				},
+				Status: v1alpha1.QWorkerStatus{},
+			}
+			Expect(k8sClient.Create(ctx, qworkerResource)).To(Succeed())
+
+			ownedPods := func() []corev1.Pod {
+				podList := &corev1.PodList{}
+				Expect(k8sClient.List(ctx, podList, ctrlclient.InNamespace(namespace))).To(Succeed())
+				var pods []corev1.Pod
+				for _, pod := range podList.Items {
+					if strings.Contains(pod.Name, testID) {
+						pods = append(pods, pod)
+					}
+				}
+				return pods
+			}
+			drainingPods := func() int {
+				draining := 0
+				for _, pod := range ownedPods() {
+					if _, ok := pod.Annotations[v1alpha1.DrainDeadlineAnnotation]; ok {
+						draining++
+					}
+				}
+				return draining
+			}
+
+			Eventually(ownedPods, 15*time.Second, 500*time.Millisecond).Should(HaveLen(3))
+
+			// Drain the queue and expect the surplus pods to be marked for draining
+			queueLength.Store(0)
+			Eventually(drainingPods, 15*time.Second, 500*time.Millisecond).Should(Equal(2))
+
+			Expect(k8sClient.Get(ctx, ctrlclient.ObjectKeyFromObject(qworkerResource), qworkerResource)).To(Succeed())
+			Expect(qworkerResource.Status.CurrentReplicas).To(Equal(1))
+			Expect(qworkerResource.Status.DrainingReplicas).To(Equal(2))
+
+			// Acknowledged pods are deleted before their deadline
+			for _, pod := range ownedPods() {
+				if _, ok := pod.Annotations[v1alpha1.DrainDeadlineAnnotation]; ok {
+					patch := ctrlclient.MergeFrom(pod.DeepCopy())
+					pod.Annotations[v1alpha1.DrainAcknowledgedAnnotation] = "true"
+					Expect(k8sClient.Patch(ctx, &pod, patch)).To(Succeed())
+				}
+			}
+			Eventually(drainingPods, 15*time.Second, 500*time.Millisecond).Should(BeZero())
+			Expect(ownedPods()).To(HaveLen(1))
+
+			// Cleanup resources
+			Expect(k8sClient.Delete(ctx, qworkerResource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, scalerConfigResource)).To(Succeed())
+			delete(brokers.BrokerRegistry, configKey)
+		})
+
+		It("should replace outdated pods when the pod spec changes", func() {
+			// Unique test identifiers
+			testID := fmt.Sprintf("test-%d", time.Now().UnixNano())
+			resourceName := fmt.Sprintf("qworker-%s", testID)
+			scalerConfigName := fmt.Sprintf("scalerconfig-%s", testID)
+			configKey := fmt.Sprintf("%s/%s", namespace, scalerConfigName)
+
+			// Mock Broker
+			brokerMock := &mocks.Broker{}
+			brokers.BrokerRegistry[configKey] = brokerMock
+			brokers.RegisterBrokerType(configKey, func(*v1alpha1.ScalerConfig) (brokers.Broker, error) { return brokerMock, nil }, nil)
+			DeferCleanup(brokers.UnregisterBrokerType, configKey)
+			brokerMock.On("Close").Return(nil).Maybe()
+			brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(2, nil)
+			brokerMock.On("IsConnected", mock.Anything).Return(true, nil)
+
+			// Create ScalerConfig resource
+			scalerConfigResource := &v1alpha1.ScalerConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      scalerConfigName,
+					Namespace: namespace,
+				},
+				Spec: v1alpha1.ScalerConfigSpec{
+					Type:   configKey,
+					Config: v1alpha1.ScalerTypeConfigs{},
+				},
+			}
+			Expect(k8sClient.Create(ctx, scalerConfigResource)).To(Succeed())
+
+			// Create QWorker resource
+			qworkerResource := &v1alpha1.QWorker{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: namespace,
+				},
+				Spec: v1alpha1.QWorkerSpec{
+					PodSpec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:  "worker-container",
+								Image: "busybox:1.36",
+							},
+						},
+					},
+					ScaleConfig: v1alpha1.QWorkerScaleConfig{
+						ScalerConfigRef: scalerConfigName,
+						Queue:           "test-queue",
+						MinReplicas:     1,
+						MaxReplicas:     2,
+						ScalingFactor:   ptr.To(1),
+					},
+				},
+				Status: v1alpha1.QWorkerStatus{},
+			}
+			Expect(k8sClient.Create(ctx, qworkerResource)).To(Succeed())
+
+			podImages := func() []string {
+				podList := &corev1.PodList{}
+				Expect(k8sClient.List(ctx, podList, ctrlclient.InNamespace(namespace))).To(Succeed())
+				var images []string
+				for _, pod := range podList.Items {
+					if strings.Contains(pod.Name, testID) && pod.DeletionTimestamp == nil {
+						images = append(images, pod.Spec.Containers[0].Image)
+					}
+				}
+				return images
+			}
+			Eventually(podImages, 15*time.Second, 500*time.Millisecond).Should(ConsistOf("busybox:1.36", "busybox:1.36"))
+
+			// Push a new image
+			Expect(k8sClient.Get(ctx, ctrlclient.ObjectKeyFromObject(qworkerResource), qworkerResource)).To(Succeed())
+			qworkerResource.Spec.PodSpec.Containers[0].Image = "busybox:1.37"
+			Expect(k8sClient.Update(ctx, qworkerResource)).To(Succeed())
+
+			Eventually(podImages, 30*time.Second, 500*time.Millisecond).Should(ConsistOf("busybox:1.37", "busybox:1.37"))
+			Eventually(func() int {
+				Expect(k8sClient.Get(ctx, ctrlclient.ObjectKeyFromObject(qworkerResource), qworkerResource)).To(Succeed())
+				return qworkerResource.Status.OutdatedReplicas
+			}, 15*time.Second, 500*time.Millisecond).Should(BeZero())
+			Expect(qworkerResource.Status.UpdatedReplicas).To(Equal(2))
+
+			// Cleanup resources
+			Expect(k8sClient.Delete(ctx, qworkerResource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, scalerConfigResource)).To(Succeed())
+			delete(brokers.BrokerRegistry, configKey)
+		})
+
 	})
 })
+
+func TestReconcileDeletesFinishedWorkers(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	qworker := &v1alpha1.QWorker{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "default", UID: types.UID("qworker-uid")},
+		Status:     v1alpha1.QWorkerStatus{DesiredReplicas: 1},
+	}
+	podSpecHash, err := GeneratePodSpecHash(qworker.Spec.PodSpec)
+	if err != nil {
+		t.Fatalf("GeneratePodSpecHash failed: %v", err)
+	}
+	workerPod := func(name string, phase corev1.PodPhase) *corev1.Pod {
+		controller := true
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: map[string]string{v1alpha1.PodSpecHashAnnotation: podSpecHash},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: v1alpha1.GroupVersion.String(), Kind: "QWorker", Name: qworker.Name, UID: qworker.UID, Controller: &controller,
+				}},
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(qworker, workerPod("running", corev1.PodRunning), workerPod("succeeded", corev1.PodSucceeded), workerPod("failed", corev1.PodFailed)).
+		WithStatusSubresource(qworker).
+		WithIndex(&corev1.Pod{}, "metadata.ownerReferences.name", func(obj ctrlclient.Object) []string {
+			return []string{obj.GetOwnerReferences()[0].Name}
+		}).
+		Build()
+	r := &QWorkerReconciler{Client: client, Scheme: scheme}
+
+	ctx := context.Background()
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: ctrlclient.ObjectKeyFromObject(qworker)}); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+
+	var pods corev1.PodList
+	if err := client.List(ctx, &pods, ctrlclient.InNamespace("default")); err != nil {
+		t.Fatalf("Failed to list pods: %v", err)
+	}
+	if names := podNames(pods.Items); len(names) != 1 || names[0] != "running" {
+		t.Errorf("Expected only the running worker to be left, got %v", names)
+	}
+
+	updatedQWorker := &v1alpha1.QWorker{}
+	if err := client.Get(ctx, ctrlclient.ObjectKeyFromObject(qworker), updatedQWorker); err != nil {
+		t.Fatalf("Failed to get QWorker: %v", err)
+	}
+	if updatedQWorker.Status.CurrentReplicas != 1 {
+		t.Errorf("Expected 1 current replica, got %d", updatedQWorker.Status.CurrentReplicas)
+	}
+}
@@ -19,25 +19,54 @@ package controller
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/quickube/QScaler/api/v1alpha1"
 	"github.com/quickube/QScaler/internal/brokers"
+	"github.com/quickube/QScaler/internal/metrics"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
+const (
+	defaultHealthCheckInterval   = 30 * time.Second
+	defaultMaxHealthCheckBackoff = 5 * time.Minute
+	// initialHealthCheckBackoff is when an unreachable broker is probed again after its first failure
+	initialHealthCheckBackoff = 5 * time.Second
+	// healthCheckTimeout bounds a single connection check of a broker
+	healthCheckTimeout = 10 * time.Second
+)
+
 // ScalerConfigReconciler reconciles a ScalerConfig object
 type ScalerConfigReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+	// HealthCheckInterval is how often reachable brokers are probed, unless their ScalerConfig sets its own
+	HealthCheckInterval time.Duration
+	// MaxHealthCheckBackoff caps the backoff between the probes of an unreachable broker
+	MaxHealthCheckBackoff time.Duration
+}
+
+// brokerProbe is the result of a connection check of the broker of a ScalerConfig
+type brokerProbe struct {
+	status  metav1.ConditionStatus
+	reason  string
+	message string
+	// latency is nil when the broker could not be created, so its connection was not checked
+	latency *time.Duration
 }
 
 // +kubebuilder:rbac:groups=quickube.com,resources=scalerconfigs,verbs=get;list;watch;create;update;patch
@@ -47,7 +76,6 @@ type ScalerConfigReconciler struct {
 
 func (r *ScalerConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	var err error
-	var ok bool
 
 	reqLogger := log.FromContext(ctx)
 	reqLogger.Info(fmt.Sprintf("reconcileing Scaler: %s", req.Name))
@@ -55,6 +83,9 @@ func (r *ScalerConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	scalerConfig := &v1alpha1.ScalerConfig{}
 	if err = r.Get(ctx, req.NamespacedName, scalerConfig); err != nil {
 		if errors.IsNotFound(err) {
+			// a broker created by a poll that raced with the removal of the finalizer is dropped here
+			metrics.DeleteScalerConfigMetrics(req.NamespacedName)
+			brokers.RemoveBroker(req.Namespace, req.Name)
 			return reconcile.Result{}, nil
 		}
 
@@ -62,49 +93,140 @@ func (r *ScalerConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, err
 	}
 
-	broker, err := brokers.NewBroker(scalerConfig)
-	if err != nil {
-		r.Recorder.Eventf(scalerConfig, corev1.EventTypeWarning, "FailedToCreateBroker", err.Error())
-		reqLogger.Error(err, fmt.Sprintf("unable to create broker %s", req.NamespacedName))
-		_ = r.updateScalerHealth(&ctx, scalerConfig, false)
-		return ctrl.Result{}, err
+	if !scalerConfig.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(scalerConfig, v1alpha1.BrokerFinalizer) {
+			brokers.RemoveBroker(scalerConfig.Namespace, scalerConfig.Name)
+			metrics.DeleteScalerConfigMetrics(req.NamespacedName)
+			patch := client.MergeFrom(scalerConfig.DeepCopy())
+			controllerutil.RemoveFinalizer(scalerConfig, v1alpha1.BrokerFinalizer)
+			if err = r.Patch(ctx, scalerConfig, patch); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
 	}
 
-	r.Recorder.Eventf(scalerConfig, corev1.EventTypeNormal, "Broker", "Broker %s initilizaed", scalerConfig.Spec.Type)
+	// the finalizers are patched alone, so ScalerConfigs created before the webhook validated them are not rejected
+	patch := client.MergeFrom(scalerConfig.DeepCopy())
+	if controllerutil.AddFinalizer(scalerConfig, v1alpha1.BrokerFinalizer) {
+		if err = r.Patch(ctx, scalerConfig, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
-	if ok, err = broker.IsConnected(&ctx); !ok || err != nil {
-		reqLogger.Error(err, "Failed to connect to broker", "name", req.NamespacedName)
-		r.Recorder.Eventf(scalerConfig, corev1.EventTypeWarning, "Broker", "Failed to connect to broker %s", req.NamespacedName)
-		_ = r.updateScalerHealth(&ctx, scalerConfig, false)
+	probe := r.probeBroker(ctx, scalerConfig)
+	if err = r.updateScalerHealth(&ctx, scalerConfig, probe); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	r.Recorder.Eventf(scalerConfig, corev1.EventTypeNormal, "Broker", "Broker %s created suceffully ", scalerConfig.Spec.Type)
-	reqLogger.Info("ScalerConfig reconciled", "name", req.NamespacedName)
-	err = r.updateScalerHealth(&ctx, scalerConfig, true)
+	if probe.status == metav1.ConditionTrue {
+		reqLogger.Info("ScalerConfig reconciled", "name", req.NamespacedName)
+		return ctrl.Result{RequeueAfter: r.healthCheckInterval(scalerConfig)}, nil
+	}
+	return ctrl.Result{RequeueAfter: r.healthCheckBackoff(scalerConfig.Status.ConsecutiveFailures)}, nil
+}
+
+// probeBroker creates the broker of the ScalerConfig if needed and checks that it is connected
+func (r *ScalerConfigReconciler) probeBroker(ctx context.Context, scalerConfig *v1alpha1.ScalerConfig) brokerProbe {
+	reqLogger := log.FromContext(ctx)
+
+	broker, err := brokers.GetOrCreateBroker(scalerConfig)
 	if err != nil {
-		return ctrl.Result{}, err
+		reqLogger.Error(err, "unable to create broker", "name", scalerConfig.Name)
+		return brokerProbe{status: metav1.ConditionFalse, reason: "FailedCreateBroker", message: err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	ok, err := broker.IsConnected(&ctx)
+	latency := time.Since(start)
+	metrics.ObserveBrokerRequest(scalerConfig, metrics.IsConnectedOperation, start, err)
+	if !ok || err != nil {
+		reqLogger.Error(err, "Failed to connect to broker", "name", scalerConfig.Name)
+		message := "the broker is not connected"
+		if err != nil {
+			message = err.Error()
+		}
+		return brokerProbe{status: metav1.ConditionFalse, reason: "ConnectionFailed", message: message, latency: &latency}
+	}
+	return brokerProbe{
+		status:  metav1.ConditionTrue,
+		reason:  "Connected",
+		message: fmt.Sprintf("connected to the %s broker", scalerConfig.Spec.Type),
+		latency: &latency,
+	}
+}
+
+// healthCheckInterval returns how often the broker of a reachable ScalerConfig is probed
+func (r *ScalerConfigReconciler) healthCheckInterval(scalerConfig *v1alpha1.ScalerConfig) time.Duration {
+	if scalerConfig.Spec.HealthCheckIntervalSeconds > 0 {
+		return time.Duration(scalerConfig.Spec.HealthCheckIntervalSeconds) * time.Second
+	}
+	if r.HealthCheckInterval > 0 {
+		return r.HealthCheckInterval
+	}
+	return defaultHealthCheckInterval
+}
+
+// healthCheckBackoff returns when an unreachable broker is probed again, doubling with each consecutive failure
+func (r *ScalerConfigReconciler) healthCheckBackoff(failures int) time.Duration {
+	maxBackoff := r.MaxHealthCheckBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxHealthCheckBackoff
 	}
 
-	return ctrl.Result{}, nil
+	backoff := initialHealthCheckBackoff
+	for i := 1; i < failures && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
 }
 
 func (r *ScalerConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.ScalerConfig{}).
+		// the status is updated on every probe, so only spec changes and deletions reconcile the ScalerConfig
+		For(&v1alpha1.ScalerConfig{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Watches(
 			&corev1.Secret{}, // Watch Secret resources
 			handler.EnqueueRequestsFromMapFunc(r.SecretToScalerConfigMapFunc())).
 		Complete(r)
 }
 
-func (r *ScalerConfigReconciler) updateScalerHealth(ctx *context.Context, scalerConfig *v1alpha1.ScalerConfig, health bool) error {
-	scalerConfig.Status.Healthy = health
+// updateScalerHealth records the probe of the broker of the ScalerConfig in its status, and emits an event
+// when the broker becomes reachable or unreachable
+func (r *ScalerConfigReconciler) updateScalerHealth(ctx *context.Context, scalerConfig *v1alpha1.ScalerConfig, probe brokerProbe) error {
+	previous := meta.FindStatusCondition(scalerConfig.Status.Conditions, v1alpha1.BrokerReachableCondition)
+	transitioned := previous == nil || previous.Status != probe.status
+
+	scalerConfig.Status.Healthy = probe.status == metav1.ConditionTrue
+	if scalerConfig.Status.Healthy {
+		scalerConfig.Status.ConsecutiveFailures = 0
+	} else {
+		scalerConfig.Status.ConsecutiveFailures++
+	}
+	now := metav1.Now()
+	scalerConfig.Status.LastProbeTime = &now
+	scalerConfig.Status.ProbeLatency = nil
+	if probe.latency != nil {
+		scalerConfig.Status.ProbeLatency = &metav1.Duration{Duration: *probe.latency}
+	}
+	scalerConfig.SetCondition(v1alpha1.BrokerReachableCondition, probe.status, probe.reason, probe.message)
+
 	log.Log.Info("Updating ScalerConfig", "name", scalerConfig.Name, "health", scalerConfig.Status.Healthy)
 	if err := r.Status().Update(*ctx, scalerConfig); err != nil {
 		log.Log.Error(err, "Failed to update scalerConfig status", "name", scalerConfig.Name)
 		return err
 	}
+
+	if transitioned {
+		if scalerConfig.Status.Healthy {
+			r.Recorder.Event(scalerConfig, corev1.EventTypeNormal, "BrokerConnected", probe.message)
+		} else {
+			r.Recorder.Event(scalerConfig, corev1.EventTypeWarning, probe.reason, probe.message)
+		}
+	}
 	return nil
 }
 
@@ -126,6 +248,9 @@ func (r *ScalerConfigReconciler) SecretToScalerConfigMapFunc() func(context.Cont
 		for _, scalerConfig := range scalerConfigList.Items {
 			if scalerConfig.ReferencesSecret(secret.Name) {
 				log.Log.Info("reconsiling due to secret change", "name", scalerConfig.Name)
+				// the generation of the ScalerConfig does not change with its secrets, so its broker is
+				// dropped to be created again with the new secret
+				brokers.RemoveBroker(scalerConfig.Namespace, scalerConfig.Name)
 				// Enqueue a reconcile request for the ScalerConfig
 				requests = append(requests, reconcile.Request{
 					NamespacedName: client.ObjectKey{
@@ -3,7 +3,8 @@ package controller
 import (
 	"context"
 	"fmt"
-
+	"strings"
+	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -13,8 +14,13 @@ import (
 	"github.com/quickube/QScaler/internal/mocks"
 	"github.com/stretchr/testify/mock"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 var _ = Describe("ScalerConfigReconciler", func() {
@@ -60,6 +66,9 @@ var _ = Describe("ScalerConfigReconciler", func() {
 			// Mock broker
 			brokerMock := &mocks.Broker{}
 			brokers.BrokerRegistry[brokerKey] = brokerMock
+			brokers.RegisterBrokerType(brokerKey, func(*v1alpha1.ScalerConfig) (brokers.Broker, error) { return brokerMock, nil }, nil)
+			DeferCleanup(brokers.UnregisterBrokerType, brokerKey)
+			brokerMock.On("Close").Return(nil).Maybe()
 			brokerMock.On("IsConnected", mock.Anything).Return(true, nil)
 
 			// Create resources in the fake Kubernetes cluster
@@ -80,10 +89,21 @@ var _ = Describe("ScalerConfigReconciler", func() {
 				}
 				return updated.Status.Healthy
 			}, time.Second*10, time.Millisecond*500).Should(BeTrue(), "ScalerConfig should be marked as healthy")
+			Expect(meta.IsStatusConditionTrue(updated.Status.Conditions, v1alpha1.BrokerReachableCondition)).To(BeTrue(),
+				"ScalerConfig should report its broker as reachable")
+			Expect(updated.Finalizers).To(ContainElement(v1alpha1.BrokerFinalizer))
 
 			// Cleanup resources
 			Expect(k8sManager.GetClient().Delete(ctx, scalerConfig)).To(Succeed())
 			Expect(k8sManager.GetClient().Delete(ctx, secret)).To(Succeed())
+
+			// Verify the finalizer removes the broker before the ScalerConfig is gone
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: scalerConfigName, Namespace: "default"}, &v1alpha1.ScalerConfig{})
+				return errors.IsNotFound(err)
+			}, time.Second*10, time.Millisecond*500).Should(BeTrue(), "ScalerConfig should be deleted")
+			_, err = brokers.GetBroker("default", scalerConfigName)
+			Expect(err).To(HaveOccurred(), "expected the broker of the deleted ScalerConfig to be removed")
 			delete(brokers.BrokerRegistry, brokerKey)
 		})
 
@@ -128,6 +148,9 @@ var _ = Describe("ScalerConfigReconciler", func() {
 			// Mock broker
 			brokerMock := &mocks.Broker{}
 			brokers.BrokerRegistry[brokerKey] = brokerMock
+			brokers.RegisterBrokerType(brokerKey, func(*v1alpha1.ScalerConfig) (brokers.Broker, error) { return brokerMock, nil }, nil)
+			DeferCleanup(brokers.UnregisterBrokerType, brokerKey)
+			brokerMock.On("Close").Return(nil).Maybe()
 			brokerMock.On("IsConnected", mock.Anything).Return(false, nil)
 
 			// Create resources in the fake Kubernetes cluster
@@ -146,10 +169,136 @@ var _ = Describe("ScalerConfigReconciler", func() {
 				}
 				return updated.Status.Healthy
 			}, time.Second*10, time.Millisecond*500).Should(BeFalse(), "ScalerConfig should be marked as unhealthy")
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: scalerConfigName, Namespace: "default"}, updated)
+				if err != nil {
+					return false
+				}
+				return meta.IsStatusConditionFalse(updated.Status.Conditions, v1alpha1.BrokerReachableCondition)
+			}, time.Second*10, time.Millisecond*500).Should(BeTrue(), "ScalerConfig should report its broker as unreachable")
 
 			// Cleanup resources
 			Expect(k8sManager.GetClient().Delete(ctx, scalerConfig)).To(Succeed())
 			delete(brokers.BrokerRegistry, brokerKey)
 		})
+
+		It("should probe the broker again and mark the ScalerConfig unhealthy once it goes down", func() {
+			testID := fmt.Sprintf("test-%d", time.Now().UnixNano())
+			scalerConfigName := fmt.Sprintf("scalerconfig-%s", testID)
+			brokerKey := fmt.Sprintf("%s/%s", "default", scalerConfigName)
+
+			scalerConfig := &v1alpha1.ScalerConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      scalerConfigName,
+					Namespace: "default",
+				},
+				Spec: v1alpha1.ScalerConfigSpec{
+					Type:                       brokerKey,
+					HealthCheckIntervalSeconds: 1,
+				},
+			}
+
+			// The broker is reachable on the first probe only
+			brokerMock := &mocks.Broker{}
+			brokers.RegisterBrokerType(brokerKey, func(*v1alpha1.ScalerConfig) (brokers.Broker, error) { return brokerMock, nil }, nil)
+			DeferCleanup(brokers.UnregisterBrokerType, brokerKey)
+			brokerMock.On("Close").Return(nil).Maybe()
+			brokerMock.On("IsConnected", mock.Anything).Return(true, nil).Once()
+			brokerMock.On("IsConnected", mock.Anything).Return(false, fmt.Errorf("connection refused"))
+
+			Expect(k8sClient.Create(context.Background(), scalerConfig)).To(Succeed())
+
+			updated := &v1alpha1.ScalerConfig{}
+			Eventually(func() bool {
+				err := k8sClient.Get(ctx, client.ObjectKey{Name: scalerConfigName, Namespace: "default"}, updated)
+				return err == nil && updated.Status.ConsecutiveFailures > 0
+			}, time.Second*10, time.Millisecond*500).Should(BeTrue(), "ScalerConfig should be probed again")
+			Expect(updated.Status.Healthy).To(BeFalse())
+			Expect(updated.Status.LastProbeTime).ToNot(BeNil())
+			Expect(updated.Status.ProbeLatency).ToNot(BeNil())
+			Expect(meta.IsStatusConditionFalse(updated.Status.Conditions, v1alpha1.BrokerReachableCondition)).To(BeTrue())
+
+			Expect(k8sManager.GetClient().Delete(ctx, scalerConfig)).To(Succeed())
+		})
 	})
 })
+
+func TestHealthCheckBackoff(t *testing.T) {
+	r := &ScalerConfigReconciler{MaxHealthCheckBackoff: time.Minute}
+
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 0, expected: 5 * time.Second},
+		{failures: 1, expected: 5 * time.Second},
+		{failures: 2, expected: 10 * time.Second},
+		{failures: 4, expected: 40 * time.Second},
+		{failures: 5, expected: time.Minute},
+		{failures: 1000, expected: time.Minute},
+	}
+	for _, tt := range tests {
+		if backoff := r.healthCheckBackoff(tt.failures); backoff != tt.expected {
+			t.Errorf("expected a backoff of %s after %d failures, got %s", tt.expected, tt.failures, backoff)
+		}
+	}
+
+	interval := r.healthCheckInterval(&v1alpha1.ScalerConfig{})
+	if interval != defaultHealthCheckInterval {
+		t.Errorf("expected the default health check interval, got %s", interval)
+	}
+	interval = r.healthCheckInterval(&v1alpha1.ScalerConfig{Spec: v1alpha1.ScalerConfigSpec{HealthCheckIntervalSeconds: 7}})
+	if interval != 7*time.Second {
+		t.Errorf("expected the health check interval of the ScalerConfig, got %s", interval)
+	}
+}
+
+func TestUpdateScalerHealth(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+	scalerConfig := &v1alpha1.ScalerConfig{ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "default"}}
+	recorder := record.NewFakeRecorder(10)
+	r := &ScalerConfigReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(scalerConfig).WithStatusSubresource(scalerConfig).Build(),
+		Recorder: recorder,
+	}
+
+	latency := 3 * time.Millisecond
+	healthy := brokerProbe{status: metav1.ConditionTrue, reason: "Connected", message: "connected", latency: &latency}
+	unhealthy := brokerProbe{status: metav1.ConditionFalse, reason: "ConnectionFailed", message: "connection refused", latency: &latency}
+
+	ctx := context.Background()
+	probes := []struct {
+		probe               brokerProbe
+		expectedFailures    int
+		expectedEventReason string
+	}{
+		{probe: healthy, expectedEventReason: "BrokerConnected"},
+		{probe: healthy},
+		{probe: unhealthy, expectedFailures: 1, expectedEventReason: "ConnectionFailed"},
+		{probe: unhealthy, expectedFailures: 2},
+		{probe: healthy, expectedEventReason: "BrokerConnected"},
+	}
+	for i, p := range probes {
+		if err := r.updateScalerHealth(&ctx, scalerConfig, p.probe); err != nil {
+			t.Fatalf("probe %d: updateScalerHealth failed: %v", i, err)
+		}
+		if scalerConfig.Status.ConsecutiveFailures != p.expectedFailures {
+			t.Errorf("probe %d: expected %d consecutive failures, got %d", i, p.expectedFailures, scalerConfig.Status.ConsecutiveFailures)
+		}
+		if scalerConfig.Status.ProbeLatency == nil || scalerConfig.Status.ProbeLatency.Duration != latency {
+			t.Errorf("probe %d: expected a probe latency of %s, got %v", i, latency, scalerConfig.Status.ProbeLatency)
+		}
+
+		select {
+		case event := <-recorder.Events:
+			if p.expectedEventReason == "" || !strings.Contains(event, p.expectedEventReason) {
+				t.Errorf("probe %d: unexpected event %q", i, event)
+			}
+		default:
+			if p.expectedEventReason != "" {
+				t.Errorf("probe %d: expected a %s event", i, p.expectedEventReason)
+			}
+		}
+	}
+}
@@ -103,7 +103,7 @@ var _ = BeforeSuite(func() {
 	}
 	Expect(reconciler.SetupWithManager(k8sManager)).To(Succeed())
 
-	metrics.StartServer(ctx, k8sManager)
+	Expect(metrics.SetupWithManager(k8sManager, metrics.Options{})).To(Succeed())
 
 	By("Initializing the ScalerConfigReconciler")
 	reconciler2 = &ScalerConfigReconciler{
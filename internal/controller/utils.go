@@ -4,8 +4,12 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"sort"
+	"time"
 
+	"github.com/quickube/QScaler/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/json"
 )
 
@@ -23,3 +27,140 @@ func GeneratePodSpecHash(podSpec corev1.PodSpec) (string, error) {
 	// Convert the hash to a hex string
 	return hex.EncodeToString(hash[:]), nil
 }
+
+// isPodFinished reports whether all the pod's containers have terminated for good
+func isPodFinished(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+// isPodReady reports whether the pod has the Ready condition set
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// drainDeadline returns the deadline of a pod that was selected for scale-down
+func drainDeadline(pod *corev1.Pod) (time.Time, bool) {
+	value, ok := pod.Annotations[v1alpha1.DrainDeadlineAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	deadline, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		// a malformed deadline should not keep the pod around forever
+		return time.Time{}, true
+	}
+	return deadline, true
+}
+
+// isDrainAcknowledged reports whether the worker confirmed it is safe to delete
+func isDrainAcknowledged(pod *corev1.Pod) bool {
+	return pod.Annotations[v1alpha1.DrainAcknowledgedAnnotation] == "true"
+}
+
+// splitPods separates the pods of a QWorker into the ones serving the queue, the ones being drained, and the
+// ones that finished on their own and are left to be deleted. Pods that are already being deleted belong to none.
+func splitPods(pods []corev1.Pod) (active []corev1.Pod, draining []corev1.Pod, finished []corev1.Pod) {
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if _, ok := drainDeadline(&pod); ok {
+			draining = append(draining, pod)
+			continue
+		}
+		if isPodFinished(&pod) {
+			finished = append(finished, pod)
+			continue
+		}
+		active = append(active, pod)
+	}
+	return active, draining, finished
+}
+
+// sortPodsForDrain orders pods so the cheapest ones to lose come first:
+// pods that are not ready yet, and then the most recently created ones.
+func sortPodsForDrain(pods []corev1.Pod) {
+	sort.SliceStable(pods, func(i, j int) bool {
+		iReady, jReady := isPodReady(&pods[i]), isPodReady(&pods[j])
+		if iReady != jReady {
+			return !iReady
+		}
+		return pods[j].CreationTimestamp.Before(&pods[i].CreationTimestamp)
+	})
+}
+
+// podSpecHash returns the hash of the pod spec a worker pod was created from
+func podSpecHash(pod *corev1.Pod) string {
+	if hash, ok := pod.Annotations[v1alpha1.PodSpecHashAnnotation]; ok {
+		return hash
+	}
+	// workers created before the annotation was introduced only carry the hash in their environment
+	for _, container := range pod.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name == "POD_SPEC_HASH" {
+				return env.Value
+			}
+		}
+	}
+	return ""
+}
+
+// workerLabels returns the labels of the worker pods of a QWorker
+func workerLabels(qworker *v1alpha1.QWorker) map[string]string {
+	return map[string]string{v1alpha1.QWorkerLabel: qworker.Name}
+}
+
+// splitPodsBySpecHash separates pods running the given pod spec hash from outdated ones
+func splitPodsBySpecHash(pods []corev1.Pod, hash string) (updated []corev1.Pod, outdated []corev1.Pod) {
+	for _, pod := range pods {
+		if podSpecHash(&pod) == hash {
+			updated = append(updated, pod)
+		} else {
+			outdated = append(outdated, pod)
+		}
+	}
+	return updated, outdated
+}
+
+// countReadyPods returns the number of pods that have the Ready condition set
+func countReadyPods(pods []corev1.Pod) int {
+	ready := 0
+	for i := range pods {
+		if isPodReady(&pods[i]) {
+			ready++
+		}
+	}
+	return ready
+}
+
+// rolloutBudget resolves the surge and unavailability limits of a rollout strategy against the desired replicas
+func rolloutBudget(strategy v1alpha1.QWorkerRolloutStrategy, desiredReplicas int) (int, int, error) {
+	defaultBudget := intstr.FromString("25%")
+	maxSurge, maxUnavailable := &defaultBudget, &defaultBudget
+	if strategy.MaxSurge != nil {
+		maxSurge = strategy.MaxSurge
+	}
+	if strategy.MaxUnavailable != nil {
+		maxUnavailable = strategy.MaxUnavailable
+	}
+
+	surge, err := intstr.GetScaledValueFromIntOrPercent(maxSurge, desiredReplicas, true)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid maxSurge: %w", err)
+	}
+	unavailable, err := intstr.GetScaledValueFromIntOrPercent(maxUnavailable, desiredReplicas, false)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid maxUnavailable: %w", err)
+	}
+
+	// a rollout with no room to surge nor to lose a worker could never make progress
+	if surge == 0 && unavailable == 0 {
+		unavailable = 1
+	}
+	return surge, unavailable, nil
+}
@@ -3,12 +3,16 @@ package controller
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 
+	"github.com/quickube/QScaler/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // TestGeneratePodTemplateHash tests the GeneratePodSpecHash function
@@ -81,3 +85,169 @@ func TestGeneratePodTemplateHash_Deterministic(t *testing.T) {
 		t.Logf("Hashes match: %v", hash1)
 	}
 }
+
+func TestSplitPods(t *testing.T) {
+	now := metav1.Now()
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "active"}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "pending"}, Status: corev1.PodStatus{Phase: corev1.PodPending}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "finished"}, Status: corev1.PodStatus{Phase: corev1.PodSucceeded}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "deleting", DeletionTimestamp: &now}},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "draining",
+				Annotations: map[string]string{v1alpha1.DrainDeadlineAnnotation: now.UTC().Format(time.RFC3339)},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodSucceeded},
+		},
+	}
+
+	active, draining, finished := splitPods(pods)
+
+	if len(active) != 2 || active[0].Name != "active" || active[1].Name != "pending" {
+		t.Errorf("Expected active pods [active pending], got %v", podNames(active))
+	}
+	if len(draining) != 1 || draining[0].Name != "draining" {
+		t.Errorf("Expected draining pods [draining], got %v", podNames(draining))
+	}
+	if len(finished) != 1 || finished[0].Name != "finished" {
+		t.Errorf("Expected finished pods [finished], got %v", podNames(finished))
+	}
+}
+
+func TestSortPodsForDrain(t *testing.T) {
+	base := time.Now()
+	readyCondition := []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	pods := []corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "old-ready", CreationTimestamp: metav1.NewTime(base)},
+			Status:     corev1.PodStatus{Conditions: readyCondition},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "new-ready", CreationTimestamp: metav1.NewTime(base.Add(time.Minute))},
+			Status:     corev1.PodStatus{Conditions: readyCondition},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "old-unready", CreationTimestamp: metav1.NewTime(base)},
+		},
+	}
+
+	sortPodsForDrain(pods)
+
+	expected := []string{"old-unready", "new-ready", "old-ready"}
+	if !reflect.DeepEqual(podNames(pods), expected) {
+		t.Errorf("Expected drain order %v, got %v", expected, podNames(pods))
+	}
+}
+
+func TestDrainDeadline(t *testing.T) {
+	deadline := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{v1alpha1.DrainDeadlineAnnotation: deadline.Format(time.RFC3339)},
+	}}
+
+	actual, ok := drainDeadline(pod)
+	if !ok || !actual.Equal(deadline) {
+		t.Errorf("Expected deadline %v, got %v (draining: %v)", deadline, actual, ok)
+	}
+
+	pod.Annotations[v1alpha1.DrainDeadlineAnnotation] = "not-a-time"
+	actual, ok = drainDeadline(pod)
+	if !ok || !actual.IsZero() {
+		t.Errorf("Expected malformed deadline to expire immediately, got %v (draining: %v)", actual, ok)
+	}
+
+	if _, ok = drainDeadline(&corev1.Pod{}); ok {
+		t.Errorf("Expected pod without annotation not to be draining")
+	}
+}
+
+func podNames(pods []corev1.Pod) []string {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+func TestSplitPodsBySpecHash(t *testing.T) {
+	pods := []corev1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "updated", Annotations: map[string]string{v1alpha1.PodSpecHashAnnotation: "new"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "outdated", Annotations: map[string]string{v1alpha1.PodSpecHashAnnotation: "old"}}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy"},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "worker", Env: []corev1.EnvVar{{Name: "POD_SPEC_HASH", Value: "new"}}},
+			}},
+		},
+	}
+
+	updated, outdated := splitPodsBySpecHash(pods, "new")
+
+	if !reflect.DeepEqual(podNames(updated), []string{"updated", "legacy"}) {
+		t.Errorf("Expected updated pods [updated legacy], got %v", podNames(updated))
+	}
+	if !reflect.DeepEqual(podNames(outdated), []string{"outdated"}) {
+		t.Errorf("Expected outdated pods [outdated], got %v", podNames(outdated))
+	}
+}
+
+func TestRolloutBudget(t *testing.T) {
+	two := intstr.FromInt32(2)
+	zero := intstr.FromInt32(0)
+	half := intstr.FromString("50%")
+	invalid := intstr.FromString("many")
+
+	tests := []struct {
+		name                string
+		strategy            v1alpha1.QWorkerRolloutStrategy
+		desiredReplicas     int
+		expectedSurge       int
+		expectedUnavailable int
+		expectedError       bool
+	}{
+		{
+			name:                "Defaults to 25% rounding surge up and unavailable down",
+			strategy:            v1alpha1.QWorkerRolloutStrategy{},
+			desiredReplicas:     10,
+			expectedSurge:       3,
+			expectedUnavailable: 2,
+		},
+		{
+			name:                "Absolute and percentage values",
+			strategy:            v1alpha1.QWorkerRolloutStrategy{MaxSurge: &two, MaxUnavailable: &half},
+			desiredReplicas:     5,
+			expectedSurge:       2,
+			expectedUnavailable: 2,
+		},
+		{
+			name:                "No surge and no unavailability still allows progress",
+			strategy:            v1alpha1.QWorkerRolloutStrategy{MaxSurge: &zero, MaxUnavailable: &zero},
+			desiredReplicas:     5,
+			expectedSurge:       0,
+			expectedUnavailable: 1,
+		},
+		{
+			name:            "Invalid value",
+			strategy:        v1alpha1.QWorkerRolloutStrategy{MaxSurge: &invalid},
+			desiredReplicas: 5,
+			expectedError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			surge, unavailable, err := rolloutBudget(tt.strategy, tt.desiredReplicas)
+			if (err != nil) != tt.expectedError {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if tt.expectedError {
+				return
+			}
+			if surge != tt.expectedSurge || unavailable != tt.expectedUnavailable {
+				t.Errorf("expected surge %d and unavailable %d, got %d and %d",
+					tt.expectedSurge, tt.expectedUnavailable, surge, unavailable)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"math"
+	"time"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The defaults of the HorizontalPodAutoscaler behavior, applied to the unset fields of a QWorker behavior
+var (
+	defaultScaleUpStabilizationWindowSeconds   int32 = 0
+	defaultScaleDownStabilizationWindowSeconds int32 = 300
+	defaultScaleUpPolicies                           = []autoscalingv2.HPAScalingPolicy{
+		{Type: autoscalingv2.PodsScalingPolicy, Value: 4, PeriodSeconds: 15},
+		{Type: autoscalingv2.PercentScalingPolicy, Value: 100, PeriodSeconds: 15},
+	}
+	defaultScaleDownPolicies = []autoscalingv2.HPAScalingPolicy{
+		{Type: autoscalingv2.PercentScalingPolicy, Value: 100, PeriodSeconds: 15},
+	}
+)
+
+// applyBehavior records the recommendation in the history of the QWorker and returns the desired
+// replicas once stabilized and limited by the scaling policies of its behavior, the same way the
+// HorizontalPodAutoscaler does. The previous desired replicas are the base the policies limit the change of.
+func applyBehavior(qworker *v1alpha1.QWorker, recommendation int, now time.Time) int {
+	scaleConfig := qworker.Spec.ScaleConfig
+	if scaleConfig.Behavior == nil {
+		qworker.Status.Recommendations = nil
+		qworker.Status.ScaleEvents = nil
+		return recommendation
+	}
+	scaleUp := scalingRules(scaleConfig.Behavior.ScaleUp, defaultScaleUpStabilizationWindowSeconds, defaultScaleUpPolicies)
+	scaleDown := scalingRules(scaleConfig.Behavior.ScaleDown, defaultScaleDownStabilizationWindowSeconds, defaultScaleDownPolicies)
+	current := qworker.Status.DesiredReplicas
+
+	recordRecommendation(&qworker.Status, recommendation, now,
+		time.Duration(max(*scaleUp.StabilizationWindowSeconds, *scaleDown.StabilizationWindowSeconds))*time.Second)
+	upRecommendation, downRecommendation := stabilizedRecommendations(qworker.Status.Recommendations, recommendation, now,
+		time.Duration(*scaleUp.StabilizationWindowSeconds)*time.Second,
+		time.Duration(*scaleDown.StabilizationWindowSeconds)*time.Second)
+
+	// hold the current replicas unless every recommendation in a window agrees on moving away from them
+	desired := current
+	if desired < upRecommendation {
+		desired = upRecommendation
+	}
+	if desired > downRecommendation {
+		desired = downRecommendation
+	}
+
+	scaleEvents := recentScaleEvents(qworker.Status.ScaleEvents, now, max(longestPeriod(scaleUp), longestPeriod(scaleDown)))
+	if desired > current {
+		// the policies never hold the replicas below minReplicas, e.g. for a new QWorker starting at 0
+		desired = max(min(desired, scaleUpLimit(current, scaleEvents, scaleUp, now), scaleConfig.MaxReplicas), scaleConfig.MinReplicas)
+	} else if desired < current {
+		desired = max(desired, scaleDownLimit(current, scaleEvents, scaleDown, now), scaleConfig.MinReplicas)
+	}
+	qworker.Status.ScaleEvents = scaleEvents
+	return desired
+}
+
+// recordScaleEvent adds the change of the desired replicas of a QWorker with a behavior to its scale events
+func recordScaleEvent(qworker *v1alpha1.QWorker, desired int, now time.Time) {
+	if qworker.Spec.ScaleConfig.Behavior == nil || desired == qworker.Status.DesiredReplicas {
+		return
+	}
+	qworker.Status.ScaleEvents = append(qworker.Status.ScaleEvents, v1alpha1.ScaleEvent{
+		Timestamp: metav1.Time{Time: now},
+		Change:    desired - qworker.Status.DesiredReplicas,
+	})
+}
+
+// scalingRules fills the unset fields of the rules of one scaling direction with their defaults
+func scalingRules(rules *autoscalingv2.HPAScalingRules, defaultWindowSeconds int32, defaultPolicies []autoscalingv2.HPAScalingPolicy) *autoscalingv2.HPAScalingRules {
+	result := &autoscalingv2.HPAScalingRules{}
+	if rules != nil {
+		result = rules.DeepCopy()
+	}
+	if result.StabilizationWindowSeconds == nil {
+		result.StabilizationWindowSeconds = &defaultWindowSeconds
+	}
+	if result.SelectPolicy == nil {
+		selectPolicy := autoscalingv2.MaxChangePolicySelect
+		result.SelectPolicy = &selectPolicy
+	}
+	if len(result.Policies) == 0 {
+		result.Policies = defaultPolicies
+	}
+	return result
+}
+
+// recordRecommendation appends a recommendation that differs from the last one and drops the ones
+// that were replaced before the window started. The one in effect at the window start is kept.
+func recordRecommendation(status *v1alpha1.QWorkerStatus, recommendation int, now time.Time, window time.Duration) {
+	recommendations := status.Recommendations
+	if len(recommendations) == 0 || recommendations[len(recommendations)-1].Replicas != recommendation {
+		recommendations = append(recommendations, v1alpha1.ReplicaRecommendation{
+			Timestamp: metav1.Time{Time: now},
+			Replicas:  recommendation,
+		})
+	}
+
+	windowStart := now.Add(-window)
+	first := 0
+	for first < len(recommendations)-1 && !recommendations[first+1].Timestamp.After(windowStart) {
+		first++
+	}
+	status.Recommendations = recommendations[first:]
+}
+
+// stabilizedRecommendations returns the lowest recommendation within the scale up window and the
+// highest one within the scale down window
+func stabilizedRecommendations(recommendations []v1alpha1.ReplicaRecommendation, recommendation int, now time.Time, upWindow, downWindow time.Duration) (int, int) {
+	upRecommendation, downRecommendation := recommendation, recommendation
+	for i, r := range recommendations {
+		// a recommendation is in a window if it was still in effect when the window started
+		end := now
+		if i+1 < len(recommendations) {
+			end = recommendations[i+1].Timestamp.Time
+		}
+		if end.After(now.Add(-upWindow)) {
+			upRecommendation = min(upRecommendation, r.Replicas)
+		}
+		if end.After(now.Add(-downWindow)) {
+			downRecommendation = max(downRecommendation, r.Replicas)
+		}
+	}
+	return upRecommendation, downRecommendation
+}
+
+func recentScaleEvents(events []v1alpha1.ScaleEvent, now time.Time, periodSeconds int32) []v1alpha1.ScaleEvent {
+	periodStart := now.Add(-time.Duration(periodSeconds) * time.Second)
+	var recent []v1alpha1.ScaleEvent
+	for _, event := range events {
+		if event.Timestamp.After(periodStart) {
+			recent = append(recent, event)
+		}
+	}
+	return recent
+}
+
+func longestPeriod(rules *autoscalingv2.HPAScalingRules) int32 {
+	var longest int32
+	for _, policy := range rules.Policies {
+		longest = max(longest, policy.PeriodSeconds)
+	}
+	return longest
+}
+
+// periodStartReplicas returns the desired replicas at the start of the period of a policy
+func periodStartReplicas(current int, events []v1alpha1.ScaleEvent, periodSeconds int32, now time.Time) int {
+	periodStart := now.Add(-time.Duration(periodSeconds) * time.Second)
+	replicas := current
+	for _, event := range events {
+		if event.Timestamp.After(periodStart) {
+			replicas -= event.Change
+		}
+	}
+	return replicas
+}
+
+// scaleUpLimit returns the highest replicas the scale up policies allow, unlimited when none of them applies
+func scaleUpLimit(current int, events []v1alpha1.ScaleEvent, rules *autoscalingv2.HPAScalingRules, now time.Time) int {
+	if *rules.SelectPolicy == autoscalingv2.DisabledPolicySelect {
+		return current
+	}
+
+	limit, matched := math.MinInt, false
+	selectPolicy := func(a, b int) int { return max(a, b) }
+	if *rules.SelectPolicy == autoscalingv2.MinChangePolicySelect {
+		limit = math.MaxInt
+		selectPolicy = func(a, b int) int { return min(a, b) }
+	}
+	for _, policy := range rules.Policies {
+		start := periodStartReplicas(current, events, policy.PeriodSeconds, now)
+		var proposed int
+		switch policy.Type {
+		case autoscalingv2.PodsScalingPolicy:
+			proposed = start + int(policy.Value)
+		case autoscalingv2.PercentScalingPolicy:
+			// rounded up and from at least one replica, so small and empty fleets can still grow
+			proposed = int(math.Ceil(float64(max(start, 1)) * (1 + float64(policy.Value)/100)))
+		default:
+			continue
+		}
+		limit, matched = selectPolicy(limit, proposed), true
+	}
+	if !matched {
+		return math.MaxInt
+	}
+	return limit
+}
+
+// scaleDownLimit returns the lowest replicas the scale down policies allow, unlimited when none of them applies
+func scaleDownLimit(current int, events []v1alpha1.ScaleEvent, rules *autoscalingv2.HPAScalingRules, now time.Time) int {
+	if *rules.SelectPolicy == autoscalingv2.DisabledPolicySelect {
+		return current
+	}
+
+	limit, matched := math.MaxInt, false
+	selectPolicy := func(a, b int) int { return min(a, b) }
+	if *rules.SelectPolicy == autoscalingv2.MinChangePolicySelect {
+		limit = math.MinInt
+		selectPolicy = func(a, b int) int { return max(a, b) }
+	}
+	for _, policy := range rules.Policies {
+		start := periodStartReplicas(current, events, policy.PeriodSeconds, now)
+		var proposed int
+		switch policy.Type {
+		case autoscalingv2.PodsScalingPolicy:
+			proposed = start - int(policy.Value)
+		case autoscalingv2.PercentScalingPolicy:
+			proposed = int(float64(start) * (1 - float64(policy.Value)/100))
+		default:
+			continue
+		}
+		limit, matched = selectPolicy(limit, proposed), true
+	}
+	if !matched {
+		return math.MinInt
+	}
+	return limit
+}
@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplyBehavior(t *testing.T) {
+	now := time.Now()
+	at := func(ago time.Duration) metav1.Time { return metav1.Time{Time: now.Add(-ago)} }
+	int32Ptr := func(i int32) *int32 { return &i }
+	selectPolicyPtr := func(p autoscalingv2.ScalingPolicySelect) *autoscalingv2.ScalingPolicySelect { return &p }
+
+	tests := []struct {
+		name           string
+		behavior       *autoscalingv2.HorizontalPodAutoscalerBehavior
+		minReplicas    int
+		status         v1alpha1.QWorkerStatus
+		recommendation int
+		expected       int
+	}{
+		{
+			name:           "Follows the recommendation without a behavior",
+			status:         v1alpha1.QWorkerStatus{DesiredReplicas: 10},
+			recommendation: 2,
+			expected:       2,
+		},
+		{
+			name: "Holds the replicas while a higher recommendation is in the scale down window",
+			behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+				ScaleDown: &autoscalingv2.HPAScalingRules{StabilizationWindowSeconds: int32Ptr(60)},
+			},
+			status: v1alpha1.QWorkerStatus{
+				DesiredReplicas: 10,
+				Recommendations: []v1alpha1.ReplicaRecommendation{
+					{Timestamp: at(90 * time.Second), Replicas: 10},
+					{Timestamp: at(30 * time.Second), Replicas: 4},
+				},
+			},
+			recommendation: 2,
+			expected:       10,
+		},
+		{
+			name: "Scales down to the highest recommendation of the scale down window",
+			behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+				ScaleDown: &autoscalingv2.HPAScalingRules{StabilizationWindowSeconds: int32Ptr(60)},
+			},
+			status: v1alpha1.QWorkerStatus{
+				DesiredReplicas: 10,
+				Recommendations: []v1alpha1.ReplicaRecommendation{
+					{Timestamp: at(120 * time.Second), Replicas: 10},
+					{Timestamp: at(70 * time.Second), Replicas: 4},
+				},
+			},
+			recommendation: 2,
+			expected:       4,
+		},
+		{
+			name:           "Scales up instantly by default",
+			behavior:       &autoscalingv2.HorizontalPodAutoscalerBehavior{},
+			status:         v1alpha1.QWorkerStatus{DesiredReplicas: 2},
+			recommendation: 6,
+			expected:       6,
+		},
+		{
+			name: "Scale up limited by the pods added within the policy period",
+			behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+				ScaleUp: &autoscalingv2.HPAScalingRules{Policies: []autoscalingv2.HPAScalingPolicy{
+					{Type: autoscalingv2.PodsScalingPolicy, Value: 2, PeriodSeconds: 60},
+				}},
+			},
+			status: v1alpha1.QWorkerStatus{
+				DesiredReplicas: 4,
+				ScaleEvents:     []v1alpha1.ScaleEvent{{Timestamp: at(30 * time.Second), Change: 1}},
+			},
+			recommendation: 10,
+			expected:       5,
+		},
+		{
+			name: "Scale up by the policy allowing the smallest change",
+			behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+				ScaleUp: &autoscalingv2.HPAScalingRules{
+					SelectPolicy: selectPolicyPtr(autoscalingv2.MinChangePolicySelect),
+					Policies: []autoscalingv2.HPAScalingPolicy{
+						{Type: autoscalingv2.PodsScalingPolicy, Value: 4, PeriodSeconds: 15},
+						{Type: autoscalingv2.PercentScalingPolicy, Value: 100, PeriodSeconds: 15},
+					},
+				},
+			},
+			status:         v1alpha1.QWorkerStatus{DesiredReplicas: 2},
+			recommendation: 10,
+			expected:       4,
+		},
+		{
+			name: "Percent scale up from zero replicas",
+			behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+				ScaleUp: &autoscalingv2.HPAScalingRules{Policies: []autoscalingv2.HPAScalingPolicy{
+					{Type: autoscalingv2.PercentScalingPolicy, Value: 100, PeriodSeconds: 60},
+				}},
+			},
+			status:         v1alpha1.QWorkerStatus{DesiredReplicas: 0},
+			recommendation: 10,
+			expected:       2,
+		},
+		{
+			name: "Scale up raised to the min replicas",
+			behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+				ScaleUp: &autoscalingv2.HPAScalingRules{SelectPolicy: selectPolicyPtr(autoscalingv2.DisabledPolicySelect)},
+			},
+			minReplicas:    2,
+			status:         v1alpha1.QWorkerStatus{DesiredReplicas: 0},
+			recommendation: 5,
+			expected:       2,
+		},
+		{
+			name: "Scale down limited by a percentage per period",
+			behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+				ScaleDown: &autoscalingv2.HPAScalingRules{
+					StabilizationWindowSeconds: int32Ptr(0),
+					Policies: []autoscalingv2.HPAScalingPolicy{
+						{Type: autoscalingv2.PercentScalingPolicy, Value: 50, PeriodSeconds: 60},
+					},
+				},
+			},
+			status:         v1alpha1.QWorkerStatus{DesiredReplicas: 10},
+			recommendation: 0,
+			expected:       5,
+		},
+		{
+			name: "Scale down disabled",
+			behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+				ScaleDown: &autoscalingv2.HPAScalingRules{
+					StabilizationWindowSeconds: int32Ptr(0),
+					SelectPolicy:               selectPolicyPtr(autoscalingv2.DisabledPolicySelect),
+				},
+			},
+			status:         v1alpha1.QWorkerStatus{DesiredReplicas: 10},
+			recommendation: 1,
+			expected:       10,
+		},
+		{
+			name: "Scale up unlimited without a known policy type",
+			behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+				ScaleUp: &autoscalingv2.HPAScalingRules{Policies: []autoscalingv2.HPAScalingPolicy{
+					{Type: "Unknown", Value: 1, PeriodSeconds: 15},
+				}},
+			},
+			minReplicas:    1,
+			status:         v1alpha1.QWorkerStatus{DesiredReplicas: 2},
+			recommendation: 10,
+			expected:       10,
+		},
+		{
+			name: "Scale down unlimited without a known policy type",
+			behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+				ScaleDown: &autoscalingv2.HPAScalingRules{
+					StabilizationWindowSeconds: int32Ptr(0),
+					Policies: []autoscalingv2.HPAScalingPolicy{
+						{Type: "Unknown", Value: 1, PeriodSeconds: 15},
+					},
+				},
+			},
+			minReplicas:    1,
+			status:         v1alpha1.QWorkerStatus{DesiredReplicas: 10},
+			recommendation: 3,
+			expected:       3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qworker := &v1alpha1.QWorker{
+				Spec: v1alpha1.QWorkerSpec{ScaleConfig: v1alpha1.QWorkerScaleConfig{
+					MinReplicas: tt.minReplicas,
+					MaxReplicas: 100,
+					Behavior:    tt.behavior,
+				}},
+				Status: tt.status,
+			}
+			actual := applyBehavior(qworker, tt.recommendation, now)
+			if actual != tt.expected {
+				t.Errorf("expected %d desired replicas, got %d", tt.expected, actual)
+			}
+
+			recommendations := qworker.Status.Recommendations
+			if tt.behavior == nil {
+				if len(recommendations) != 0 {
+					t.Errorf("expected no recommendations without a behavior, got %v", recommendations)
+				}
+				return
+			}
+			if last := recommendations[len(recommendations)-1]; last.Replicas != tt.recommendation {
+				t.Errorf("expected the recommendation %d to be recorded, got %d", tt.recommendation, last.Replicas)
+			}
+		})
+	}
+}
+
+func TestRecordRecommendation(t *testing.T) {
+	now := time.Now()
+	status := &v1alpha1.QWorkerStatus{}
+
+	recordRecommendation(status, 3, now.Add(-90*time.Second), time.Minute)
+	recordRecommendation(status, 3, now.Add(-80*time.Second), time.Minute)
+	recordRecommendation(status, 5, now.Add(-70*time.Second), time.Minute)
+	if len(status.Recommendations) != 2 {
+		t.Fatalf("expected repeated recommendations to be merged, got %v", status.Recommendations)
+	}
+
+	// the recommendation of 5 was still in effect when the window started
+	recordRecommendation(status, 7, now, time.Minute)
+	if len(status.Recommendations) != 2 || status.Recommendations[0].Replicas != 5 || status.Recommendations[1].Replicas != 7 {
+		t.Errorf("expected recommendations [5 7], got %v", status.Recommendations)
+	}
+}
+
+func TestRecordScaleEvent(t *testing.T) {
+	now := time.Now()
+	qworker := &v1alpha1.QWorker{
+		Spec:   v1alpha1.QWorkerSpec{ScaleConfig: v1alpha1.QWorkerScaleConfig{Behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{}}},
+		Status: v1alpha1.QWorkerStatus{DesiredReplicas: 4},
+	}
+
+	recordScaleEvent(qworker, 4, now)
+	if len(qworker.Status.ScaleEvents) != 0 {
+		t.Errorf("expected no scale event without a change, got %v", qworker.Status.ScaleEvents)
+	}
+
+	recordScaleEvent(qworker, 1, now)
+	if len(qworker.Status.ScaleEvents) != 1 || qworker.Status.ScaleEvents[0].Change != -3 {
+		t.Errorf("expected a scale event of -3, got %v", qworker.Status.ScaleEvents)
+	}
+}
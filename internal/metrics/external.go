@@ -0,0 +1,368 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/quickube/QScaler/internal/brokers"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	toolscache "k8s.io/client-go/tools/cache"
+	certutil "k8s.io/client-go/util/cert"
+	externalmetricsv1beta1 "k8s.io/metrics/pkg/apis/external_metrics/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const (
+	// QueueLengthMetricName is the external metric serving the length of a queue
+	QueueLengthMetricName = "qscaler-queue-length"
+
+	// The labels selecting the queue of the queue length metric, either a ScalerConfig and a queue or a QWorker
+	ScalerConfigMetricLabel = "scalerConfig"
+	QueueMetricLabel        = "queue"
+	QWorkerMetricLabel      = "qworker"
+
+	// requestHeaderConfigMap holds the CA of the client certificates the API server aggregator proxies with
+	requestHeaderConfigMapNamespace = "kube-system"
+	requestHeaderConfigMapName      = "extension-apiserver-authentication"
+	requestHeaderClientCAKey        = "requestheader-client-ca-file"
+)
+
+var externalMetricsGroupVersionPath = "/apis/" + externalmetricsv1beta1.SchemeGroupVersion.String()
+
+// ExternalMetricsOptions configure the external metrics API server
+type ExternalMetricsOptions struct {
+	// BindAddress is the address the server listens on. The server is disabled when it is empty or "0".
+	BindAddress string
+	// CertDir holds the tls.crt and tls.key the server is served with. A self-signed certificate is used when it is empty.
+	CertDir string
+	// ClientCAFile is the CA of the client certificates of the API server aggregator. It is read
+	// from the extension-apiserver-authentication ConfigMap of kube-system when it is empty.
+	ClientCAFile string
+	// TLSOpts are applied to the TLS configuration of the server
+	TLSOpts []func(*tls.Config)
+}
+
+// ExternalMetricsServer serves the length of the queues of ScalerConfigs through the external.metrics.k8s.io API,
+// so HorizontalPodAutoscalers can scale on them without their own broker credentials
+type ExternalMetricsServer struct {
+	client    client.Client
+	apiReader client.Reader
+	informers cache.Informers
+	options   ExternalMetricsOptions
+}
+
+var _ manager.LeaderElectionRunnable = &ExternalMetricsServer{}
+
+// SetupExternalMetricsWithManager adds the external metrics API server to the manager, unless it is disabled
+func SetupExternalMetricsWithManager(mgr manager.Manager, options ExternalMetricsOptions) error {
+	if options.BindAddress == "" || options.BindAddress == "0" {
+		return nil
+	}
+	return mgr.Add(&ExternalMetricsServer{
+		client:    mgr.GetClient(),
+		apiReader: mgr.GetAPIReader(),
+		informers: mgr.GetCache(),
+		options:   options,
+	})
+}
+
+// Start serves the external metrics API until the context is cancelled
+func (s *ExternalMetricsServer) Start(ctx context.Context) error {
+	if err := s.evictStaleBrokers(ctx); err != nil {
+		return err
+	}
+	tlsConfig, err := s.tlsConfig(ctx)
+	if err != nil {
+		return err
+	}
+	listener, err := tls.Listen("tcp", s.options.BindAddress, tlsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.options.BindAddress, err)
+	}
+
+	server := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Log.Error(err, "failed to shut down the external metrics server")
+		}
+	}()
+
+	log.Log.Info("serving external metrics", "address", listener.Addr().String())
+	if err = server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// evictStaleBrokers closes the broker of a ScalerConfig once it is deleted or one of its secrets changes. The
+// ScalerConfig reconciler only does so on the leader, while every replica creates brokers to serve external metrics.
+func (s *ExternalMetricsServer) evictStaleBrokers(ctx context.Context) error {
+	if s.informers == nil {
+		return nil
+	}
+	scalerConfigInformer, err := s.informers.GetInformer(ctx, &v1alpha1.ScalerConfig{})
+	if err != nil {
+		return fmt.Errorf("failed to watch ScalerConfigs: %w", err)
+	}
+	_, err = scalerConfigInformer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj any) {
+			if scalerConfig, ok := deletedObject(obj).(*v1alpha1.ScalerConfig); ok {
+				brokers.RemoveBroker(scalerConfig.Namespace, scalerConfig.Name)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// the generation of a ScalerConfig does not change with its secrets, so its broker is dropped to be
+	// created again with the new secret
+	secretInformer, err := s.informers.GetInformer(ctx, &corev1.Secret{})
+	if err != nil {
+		return fmt.Errorf("failed to watch Secrets: %w", err)
+	}
+	_, err = secretInformer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj any) {
+			oldSecret, _ := oldObj.(*corev1.Secret)
+			secret, ok := newObj.(*corev1.Secret)
+			// resyncs deliver the same version again
+			if ok && oldSecret != nil && oldSecret.ResourceVersion != secret.ResourceVersion {
+				s.removeSecretBrokers(ctx, secret)
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if secret, ok := deletedObject(obj).(*corev1.Secret); ok {
+				s.removeSecretBrokers(ctx, secret)
+			}
+		},
+	})
+	return err
+}
+
+// removeSecretBrokers drops the brokers of the ScalerConfigs referencing a Secret
+func (s *ExternalMetricsServer) removeSecretBrokers(ctx context.Context, secret *corev1.Secret) {
+	var scalerConfigs v1alpha1.ScalerConfigList
+	if err := s.client.List(ctx, &scalerConfigs, client.InNamespace(secret.Namespace)); err != nil {
+		log.Log.Error(err, "Failed to list the ScalerConfigs of Secret", "namespace", secret.Namespace, "name", secret.Name)
+		return
+	}
+	for _, scalerConfig := range scalerConfigs.Items {
+		if scalerConfig.ReferencesSecret(secret.Name) {
+			brokers.RemoveBroker(scalerConfig.Namespace, scalerConfig.Name)
+		}
+	}
+}
+
+// deletedObject returns the object of a delete event, including the last known state of one deleted while
+// the informer was disconnected
+func deletedObject(obj any) any {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+	return obj
+}
+
+// NeedLeaderElection makes every replica of the operator serve external metrics
+func (s *ExternalMetricsServer) NeedLeaderElection() bool {
+	return false
+}
+
+// Handler serves the discovery of the external metrics API and the queue length metric
+func (s *ExternalMetricsServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+externalMetricsGroupVersionPath, s.serveAPIResources)
+	mux.HandleFunc("GET "+externalMetricsGroupVersionPath+"/namespaces/{namespace}/{metric}", s.serveExternalMetric)
+	return mux
+}
+
+func (s *ExternalMetricsServer) serveAPIResources(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, &v1.APIResourceList{
+		TypeMeta:     v1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: externalmetricsv1beta1.SchemeGroupVersion.String(),
+		APIResources: []v1.APIResource{{
+			Name:       QueueLengthMetricName,
+			Namespaced: true,
+			Kind:       "ExternalMetricValueList",
+			Verbs:      v1.Verbs{"get"},
+		}},
+	})
+}
+
+func (s *ExternalMetricsServer) serveExternalMetric(w http.ResponseWriter, r *http.Request) {
+	namespace, metric := r.PathValue("namespace"), r.PathValue("metric")
+	if metric != QueueLengthMetricName {
+		writeStatus(w, apierrors.NewNotFound(externalmetricsv1beta1.Resource(metric), ""))
+		return
+	}
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		writeStatus(w, apierrors.NewBadRequest(fmt.Sprintf("invalid label selector: %s", err)))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), defaultPollTimeout)
+	defer cancel()
+	value, err := s.getQueueLength(ctx, namespace, selector)
+	if err != nil {
+		log.Log.Error(err, "Failed to serve external metric", "namespace", namespace, "selector", selector.String())
+		var statusErr apierrors.APIStatus
+		if !errors.As(err, &statusErr) {
+			statusErr = apierrors.NewServiceUnavailable(err.Error())
+		}
+		writeStatus(w, statusErr)
+		return
+	}
+	writeJSON(w, http.StatusOK, &externalmetricsv1beta1.ExternalMetricValueList{
+		TypeMeta: v1.TypeMeta{Kind: "ExternalMetricValueList", APIVersion: externalmetricsv1beta1.SchemeGroupVersion.String()},
+		Items:    []externalmetricsv1beta1.ExternalMetricValue{*value},
+	})
+}
+
+// getQueueLength reads the length of the queue selected by a ScalerConfig and a queue, or by a QWorker
+func (s *ExternalMetricsServer) getQueueLength(ctx context.Context, namespace string, selector labels.Selector) (*externalmetricsv1beta1.ExternalMetricValue, error) {
+	scalerConfigName, hasScalerConfig := selector.RequiresExactMatch(ScalerConfigMetricLabel)
+	queue, hasQueue := selector.RequiresExactMatch(QueueMetricLabel)
+	metricLabels := map[string]string{ScalerConfigMetricLabel: scalerConfigName, QueueMetricLabel: queue}
+
+	if qworkerName, ok := selector.RequiresExactMatch(QWorkerMetricLabel); ok {
+		var qworker v1alpha1.QWorker
+		if err := s.client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: qworkerName}, &qworker); err != nil {
+			return nil, err
+		}
+		scalerConfigName, hasScalerConfig = qworker.Spec.ScaleConfig.ScalerConfigRef, true
+		queue, hasQueue = qworker.Spec.ScaleConfig.Queue, true
+		metricLabels = map[string]string{QWorkerMetricLabel: qworkerName}
+	}
+	if !hasScalerConfig || !hasQueue {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("the label selector must match either the %s and %s labels or the %s label",
+			ScalerConfigMetricLabel, QueueMetricLabel, QWorkerMetricLabel))
+	}
+
+	var scalerConfig v1alpha1.ScalerConfig
+	if err := s.client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: scalerConfigName}, &scalerConfig); err != nil {
+		if apierrors.IsNotFound(err) {
+			brokers.RemoveBroker(namespace, scalerConfigName)
+		}
+		return nil, err
+	}
+	broker, err := brokers.GetOrCreateBroker(&scalerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	queueLength, err := broker.GetQueueLength(&ctx, queue)
+	ObserveBrokerRequest(&scalerConfig, GetQueueLengthOperation, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &externalmetricsv1beta1.ExternalMetricValue{
+		MetricName:   QueueLengthMetricName,
+		MetricLabels: metricLabels,
+		Timestamp:    v1.Time{Time: start},
+		Value:        *resource.NewQuantity(int64(queueLength), resource.DecimalSI),
+	}, nil
+}
+
+// tlsConfig serves the certificate of the cert dir, or a self-signed one, and requires client
+// certificates signed by the CA of the API server aggregator
+func (s *ExternalMetricsServer) tlsConfig(ctx context.Context) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if s.options.CertDir != "" {
+		watcher, err := certwatcher.New(filepath.Join(s.options.CertDir, "tls.crt"), filepath.Join(s.options.CertDir, "tls.key"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the external metrics certificate: %w", err)
+		}
+		go func() {
+			if err := watcher.Start(ctx); err != nil {
+				log.Log.Error(err, "failed to watch the external metrics certificate")
+			}
+		}()
+		tlsConfig.GetCertificate = watcher.GetCertificate
+	} else {
+		host, _, err := net.SplitHostPort(s.options.BindAddress)
+		if err != nil || host == "" {
+			host = "localhost"
+		}
+		certPEM, keyPEM, err := certutil.GenerateSelfSignedCertKey(host, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate the external metrics certificate: %w", err)
+		}
+		certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	clientCA, err := s.clientCA(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(clientCA) {
+		return nil, fmt.Errorf("no client CA certificates found for the external metrics server")
+	}
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+	for _, opt := range s.options.TLSOpts {
+		opt(tlsConfig)
+	}
+	return tlsConfig, nil
+}
+
+func (s *ExternalMetricsServer) clientCA(ctx context.Context) ([]byte, error) {
+	if s.options.ClientCAFile != "" {
+		return os.ReadFile(s.options.ClientCAFile)
+	}
+
+	var configMap corev1.ConfigMap
+	key := client.ObjectKey{Namespace: requestHeaderConfigMapNamespace, Name: requestHeaderConfigMapName}
+	if err := s.apiReader.Get(ctx, key, &configMap); err != nil {
+		return nil, fmt.Errorf("failed to read the client CA of the API server aggregator: %w", err)
+	}
+	clientCA, ok := configMap.Data[requestHeaderClientCAKey]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in ConfigMap %s", requestHeaderClientCAKey, key)
+	}
+	return []byte(clientCA), nil
+}
+
+func writeStatus(w http.ResponseWriter, err apierrors.APIStatus) {
+	status := err.Status()
+	status.TypeMeta = v1.TypeMeta{Kind: "Status", APIVersion: "v1"}
+	writeJSON(w, int(status.Code), &status)
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Log.Error(err, "failed to write external metrics response")
+	}
+}
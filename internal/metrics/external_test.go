@@ -0,0 +1,219 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/quickube/QScaler/internal/brokers"
+	"github.com/quickube/QScaler/internal/mocks"
+	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	externalmetricsv1beta1 "k8s.io/metrics/pkg/apis/external_metrics/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestExternalMetricsServer(t *testing.T) {
+	testID := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	scalerConfigName := fmt.Sprintf("scalerconfig-%s", testID)
+	qworkerName := fmt.Sprintf("qworker-%s", testID)
+	namespace := "default"
+	configKey := fmt.Sprintf("%s/%s", namespace, scalerConfigName)
+
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			&v1alpha1.ScalerConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: scalerConfigName, Namespace: namespace},
+				Spec:       v1alpha1.ScalerConfigSpec{Type: configKey},
+			},
+			&v1alpha1.QWorker{
+				ObjectMeta: metav1.ObjectMeta{Name: qworkerName, Namespace: namespace},
+				Spec: v1alpha1.QWorkerSpec{ScaleConfig: v1alpha1.QWorkerScaleConfig{
+					ScalerConfigRef: scalerConfigName,
+					Queue:           "tasks",
+				}},
+			},
+		).
+		Build()
+
+	brokerMock := &mocks.Broker{}
+	brokers.RegisterBrokerType(configKey, func(*v1alpha1.ScalerConfig) (brokers.Broker, error) { return brokerMock, nil }, nil)
+	defer brokers.UnregisterBrokerType(configKey)
+	defer delete(brokers.BrokerRegistry, configKey)
+	brokerMock.On("GetQueueLength", mock.Anything, "tasks").Return(42, nil)
+	brokerMock.On("GetQueueLength", mock.Anything, "broken").Return(-1, fmt.Errorf("connection refused"))
+
+	server := httptest.NewServer((&ExternalMetricsServer{client: client}).Handler())
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		metric        string
+		selector      string
+		expectedCode  int
+		expectedValue int64
+	}{
+		{name: "Selects the queue of a ScalerConfig", metric: QueueLengthMetricName, selector: "scalerConfig=" + scalerConfigName + ",queue=tasks", expectedCode: http.StatusOK, expectedValue: 42},
+		{name: "Selects the queue of a QWorker", metric: QueueLengthMetricName, selector: "qworker=" + qworkerName, expectedCode: http.StatusOK, expectedValue: 42},
+		{name: "Requires a queue", metric: QueueLengthMetricName, selector: "scalerConfig=" + scalerConfigName, expectedCode: http.StatusBadRequest},
+		{name: "Unknown metric", metric: "cpu", selector: "qworker=" + qworkerName, expectedCode: http.StatusNotFound},
+		{name: "Unknown ScalerConfig", metric: QueueLengthMetricName, selector: "scalerConfig=missing,queue=tasks", expectedCode: http.StatusNotFound},
+		{name: "Broker error", metric: QueueLengthMetricName, selector: "scalerConfig=" + scalerConfigName + ",queue=broken", expectedCode: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fmt.Sprintf("%s%s/namespaces/%s/%s?labelSelector=%s",
+				server.URL, externalMetricsGroupVersionPath, namespace, tt.metric, url.QueryEscape(tt.selector))
+			response, err := http.Get(path)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer response.Body.Close()
+			if response.StatusCode != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, response.StatusCode)
+			}
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			var values externalmetricsv1beta1.ExternalMetricValueList
+			if err = json.NewDecoder(response.Body).Decode(&values); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(values.Items) != 1 || values.Items[0].Value.Value() != tt.expectedValue {
+				t.Errorf("expected a queue length of %d, got %v", tt.expectedValue, values.Items)
+			}
+		})
+	}
+
+	response, err := http.Get(server.URL + externalMetricsGroupVersionPath)
+	if err != nil {
+		t.Fatalf("discovery request failed: %v", err)
+	}
+	defer response.Body.Close()
+	var resources metav1.APIResourceList
+	if err = json.NewDecoder(response.Body).Decode(&resources); err != nil {
+		t.Fatalf("failed to decode discovery: %v", err)
+	}
+	if len(resources.APIResources) != 1 || resources.APIResources[0].Name != QueueLengthMetricName {
+		t.Errorf("expected the queue length metric to be discovered, got %v", resources.APIResources)
+	}
+}
+
+func TestExternalMetricsServer_EvictsBrokerOfDeletedScalerConfig(t *testing.T) {
+	namespace := "default"
+	scalerConfigName := fmt.Sprintf("scalerconfig-test-%d", time.Now().UnixNano())
+	configKey := fmt.Sprintf("%s/%s", namespace, scalerConfigName)
+
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+	client := fake.NewClientBuilder().WithScheme(scheme).Build()
+
+	brokerMock := &mocks.Broker{}
+	brokerMock.On("Close").Return(nil)
+	brokers.RegisterBrokerType(configKey, func(*v1alpha1.ScalerConfig) (brokers.Broker, error) { return brokerMock, nil }, nil)
+	defer brokers.UnregisterBrokerType(configKey)
+	defer brokers.RemoveBroker(namespace, scalerConfigName)
+	if _, err := brokers.GetOrCreateBroker(&v1alpha1.ScalerConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: scalerConfigName, Namespace: namespace},
+		Spec:       v1alpha1.ScalerConfigSpec{Type: configKey},
+	}); err != nil {
+		t.Fatalf("failed to create broker: %v", err)
+	}
+
+	server := httptest.NewServer((&ExternalMetricsServer{client: client}).Handler())
+	defer server.Close()
+
+	selector := url.QueryEscape("scalerConfig=" + scalerConfigName + ",queue=tasks")
+	response, err := http.Get(fmt.Sprintf("%s%s/namespaces/%s/%s?labelSelector=%s",
+		server.URL, externalMetricsGroupVersionPath, namespace, QueueLengthMetricName, selector))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, response.StatusCode)
+	}
+	if _, err = brokers.GetBroker(namespace, scalerConfigName); err == nil {
+		t.Errorf("expected the broker of the deleted ScalerConfig to be removed")
+	}
+}
+
+func TestExternalMetricsServer_EvictStaleBrokers(t *testing.T) {
+	namespace := "default"
+	scalerConfigName := fmt.Sprintf("scalerconfig-test-%d", time.Now().UnixNano())
+	configKey := fmt.Sprintf("%s/%s", namespace, scalerConfigName)
+
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+	scalerConfig := &v1alpha1.ScalerConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: scalerConfigName, Namespace: namespace},
+		Spec: v1alpha1.ScalerConfigSpec{Type: configKey, Config: v1alpha1.ScalerTypeConfigs{RedisConfig: v1alpha1.RedisConfig{
+			Password: v1alpha1.ValueOrSecret{Secret: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "redis"},
+				Key:                  "password",
+			}},
+		}}},
+	}
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(scalerConfig).Build()
+	informers := &informertest.FakeInformers{Scheme: scheme}
+	server := &ExternalMetricsServer{client: client, informers: informers}
+
+	ctx := context.Background()
+	if err := server.evictStaleBrokers(ctx); err != nil {
+		t.Fatalf("failed to watch for stale brokers: %v", err)
+	}
+	secretInformer, _ := informers.FakeInformerFor(ctx, &corev1.Secret{})
+	scalerConfigInformer, _ := informers.FakeInformerFor(ctx, &v1alpha1.ScalerConfig{})
+
+	brokerMock := &mocks.Broker{}
+	brokerMock.On("Close").Return(nil)
+	brokers.RegisterBrokerType(configKey, func(*v1alpha1.ScalerConfig) (brokers.Broker, error) { return brokerMock, nil }, nil)
+	defer brokers.UnregisterBrokerType(configKey)
+	defer brokers.RemoveBroker(namespace, scalerConfigName)
+	cached := func() bool {
+		_, err := brokers.GetBroker(namespace, scalerConfigName)
+		return err == nil
+	}
+
+	secret := func(name, resourceVersion string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, ResourceVersion: resourceVersion}}
+	}
+	tests := []struct {
+		name          string
+		event         func()
+		expectedEvict bool
+	}{
+		{name: "Keeps the broker on a resync of its Secret", event: func() { secretInformer.Update(secret("redis", "1"), secret("redis", "1")) }},
+		{name: "Keeps the broker when another Secret changes", event: func() { secretInformer.Update(secret("other", "1"), secret("other", "2")) }},
+		{name: "Evicts the broker when its Secret changes", event: func() { secretInformer.Update(secret("redis", "1"), secret("redis", "2")) }, expectedEvict: true},
+		{name: "Evicts the broker when its Secret is deleted", event: func() { secretInformer.Delete(secret("redis", "2")) }, expectedEvict: true},
+		{name: "Evicts the broker when the ScalerConfig is deleted", event: func() { scalerConfigInformer.Delete(scalerConfig) }, expectedEvict: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := brokers.GetOrCreateBroker(scalerConfig); err != nil {
+				t.Fatalf("failed to create broker: %v", err)
+			}
+			tt.event()
+			if cached() == tt.expectedEvict {
+				t.Errorf("expected the broker to be evicted %v, got %v", tt.expectedEvict, !cached())
+			}
+		})
+	}
+}
@@ -14,9 +14,29 @@ import (
 var (
 	metricsServerInstance *MetricsServer
 	once                  sync.Once
+
+	defaultPollingInterval    = 5 * time.Second
+	defaultMaxConcurrentPolls = 10
+	defaultPollTimeout        = 30 * time.Second
+	// defaultFallbackFailureThreshold is the failureThreshold of fallbacks that do not set one
+	defaultFallbackFailureThreshold = 3
+	// schedulerTick is how often the scheduler looks for QWorkers that are due
+	schedulerTick = time.Second
 )
 
-func getMetricsServer(mgr manager.Manager) *MetricsServer {
+// Options configure how the metrics server polls the queues of QWorkers
+type Options struct {
+	// PollingInterval is how often QWorkers without a polling interval of their own are polled
+	PollingInterval time.Duration
+	// MaxConcurrentPolls is the number of QWorkers polled at the same time
+	MaxConcurrentPolls int
+	// PollTimeout is how long a single QWorker poll can take
+	PollTimeout time.Duration
+}
+
+var _ manager.LeaderElectionRunnable = &MetricsServer{}
+
+func getMetricsServer(mgr manager.Manager, options Options) *MetricsServer {
 	once.Do(func() {
 		// Create a metrics client
 		metricsClient, err := metricsv1beta1.NewForConfig(mgr.GetConfig())
@@ -28,35 +48,47 @@ func getMetricsServer(mgr manager.Manager) *MetricsServer {
 			Scheme:        mgr.GetScheme(),
 			metricsClient: metricsClient,
 			qworkers:      &v1alpha1.QWorkerList{},
+			queueHistory:  newQueueHistory(),
+
+			scheduler:       newPollScheduler(options.MaxConcurrentPolls),
+			pollingInterval: options.PollingInterval,
+			pollTimeout:     options.PollTimeout,
 		}
 	})
 	return metricsServerInstance
 }
 
-func StartServer(ctx context.Context, mgr manager.Manager) {
-	_ = log.FromContext(ctx)
-
-	server := getMetricsServer(mgr)
-
-	go run(ctx, *server)
-
+// SetupWithManager adds the metrics server to the manager. It only runs on the elected leader,
+// so a single replica of the operator computes scaling decisions, and stops with the manager.
+func SetupWithManager(mgr manager.Manager, options Options) error {
+	return mgr.Add(getMetricsServer(mgr, options))
 }
 
-func run(ctx context.Context, server MetricsServer) {
+// Start polls the QWorkers that are due on every tick until the context is cancelled,
+// and waits for the polls in progress before returning
+func (s *MetricsServer) Start(ctx context.Context) error {
+	log.Log.Info("starting MetricsServer loop")
 
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(schedulerTick)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			log.Log.Info("shutting down MetricsServer")
-			return
+			if s.scheduler != nil {
+				s.scheduler.Wait()
+			}
+			return nil
 		case <-ticker.C:
-			log.Log.Info("running MetricsServer reconciliation")
-			if err := server.Run(ctx); err != nil {
+			if err := s.Run(ctx); err != nil {
 				log.Log.Error(err, "failed to run MetricsServer reconciliation")
 			}
 		}
 	}
 }
+
+// NeedLeaderElection makes the manager start the metrics server only once it is elected leader
+func (s *MetricsServer) NeedLeaderElection() bool {
+	return true
+}
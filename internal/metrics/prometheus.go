@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/quickube/QScaler/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Broker operations measured by the broker request metrics
+const (
+	GetQueueLengthOperation  = "get_queue_length"
+	GetMaxConsumersOperation = "get_max_consumers"
+	IsConnectedOperation     = "is_connected"
+)
+
+// The Prometheus metrics of QScaler, served on the metrics endpoint of the manager
+var (
+	queueLengthGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "qscaler_qworker_queue_length",
+		Help: "The last observed length of the queue of a QWorker",
+	}, []string{"namespace", "qworker"})
+	desiredReplicasGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "qscaler_qworker_desired_replicas",
+		Help: "The desired number of worker replicas of a QWorker",
+	}, []string{"namespace", "qworker"})
+	currentReplicasGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "qscaler_qworker_current_replicas",
+		Help: "The current number of worker replicas of a QWorker, without the draining ones",
+	}, []string{"namespace", "qworker"})
+	podsCreatedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "qscaler_qworker_pods_created_total",
+		Help: "The number of worker pods created for a QWorker",
+	}, []string{"namespace", "qworker"})
+	podsDrainedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "qscaler_qworker_pods_drained_total",
+		Help: "The number of worker pods of a QWorker selected for scale-down or replacement",
+	}, []string{"namespace", "qworker"})
+	vpaRecommendedRequestsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "qscaler_qworker_vpa_recommended_requests",
+		Help: "The resource requests recommended for the containers of a QWorker with VPA activated, in cores and bytes",
+	}, []string{"namespace", "qworker", "container", "resource"})
+	brokerRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qscaler_broker_request_duration_seconds",
+		Help:    "The latency of the requests to the broker of a ScalerConfig",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"namespace", "scalerconfig", "broker", "operation"})
+	brokerRequestErrorsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "qscaler_broker_request_errors_total",
+		Help: "The number of failed requests to the broker of a ScalerConfig",
+	}, []string{"namespace", "scalerconfig", "broker", "operation"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		queueLengthGauge,
+		desiredReplicasGauge,
+		currentReplicasGauge,
+		podsCreatedCounter,
+		podsDrainedCounter,
+		vpaRecommendedRequestsGauge,
+		brokerRequestDuration,
+		brokerRequestErrorsCounter,
+	)
+}
+
+// RecordCurrentReplicas exports the current replicas of a QWorker
+func RecordCurrentReplicas(qworker *v1alpha1.QWorker) {
+	currentReplicasGauge.WithLabelValues(qworker.Namespace, qworker.Name).Set(float64(qworker.Status.CurrentReplicas))
+}
+
+// RecordPodCreated counts a worker pod created for a QWorker
+func RecordPodCreated(qworker *v1alpha1.QWorker) {
+	podsCreatedCounter.WithLabelValues(qworker.Namespace, qworker.Name).Inc()
+}
+
+// RecordPodDrained counts a worker pod of a QWorker selected for draining
+func RecordPodDrained(qworker *v1alpha1.QWorker) {
+	podsDrainedCounter.WithLabelValues(qworker.Namespace, qworker.Name).Inc()
+}
+
+// ObserveBrokerRequest records the latency of a request to the broker of a ScalerConfig that started at start,
+// and counts it as failed when err is set
+func ObserveBrokerRequest(scalerConfig *v1alpha1.ScalerConfig, operation string, start time.Time, err error) {
+	labels := []string{scalerConfig.Namespace, scalerConfig.Name, scalerConfig.Spec.Type, operation}
+	brokerRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	if err != nil {
+		brokerRequestErrorsCounter.WithLabelValues(labels...).Inc()
+	}
+}
+
+// DeleteQWorkerMetrics drops the metrics of a deleted QWorker
+func DeleteQWorkerMetrics(key types.NamespacedName) {
+	labels := prometheus.Labels{"namespace": key.Namespace, "qworker": key.Name}
+	queueLengthGauge.Delete(labels)
+	desiredReplicasGauge.Delete(labels)
+	currentReplicasGauge.Delete(labels)
+	podsCreatedCounter.Delete(labels)
+	podsDrainedCounter.Delete(labels)
+	vpaRecommendedRequestsGauge.DeletePartialMatch(labels)
+}
+
+// DeleteScalerConfigMetrics drops the metrics of a deleted ScalerConfig
+func DeleteScalerConfigMetrics(key types.NamespacedName) {
+	labels := prometheus.Labels{"namespace": key.Namespace, "scalerconfig": key.Name}
+	brokerRequestDuration.DeletePartialMatch(labels)
+	brokerRequestErrorsCounter.DeletePartialMatch(labels)
+}
+
+// recordQueueMetrics exports the queue length and the desired replicas of a polled QWorker
+func recordQueueMetrics(qworker *v1alpha1.QWorker) {
+	queueLengthGauge.WithLabelValues(qworker.Namespace, qworker.Name).Set(float64(qworker.Status.QueueLength))
+	recordDesiredReplicas(qworker)
+}
+
+// recordDesiredReplicas exports the desired replicas of a QWorker, including the ones kept or set by its fallback
+func recordDesiredReplicas(qworker *v1alpha1.QWorker) {
+	desiredReplicasGauge.WithLabelValues(qworker.Namespace, qworker.Name).Set(float64(qworker.Status.DesiredReplicas))
+}
+
+// recordVPARecommendations exports the resource requests VPA recommends for the containers of a QWorker
+func recordVPARecommendations(qworker *v1alpha1.QWorker) {
+	containers := qworker.Spec.PodSpec.Containers
+	for i, resources := range qworker.Status.MaxContainerResourcesUsage {
+		if i >= len(containers) {
+			break
+		}
+		for _, resourceName := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			quantity, ok := resources[resourceName]
+			if !ok {
+				continue
+			}
+			vpaRecommendedRequestsGauge.WithLabelValues(qworker.Namespace, qworker.Name, containers[i].Name, string(resourceName)).
+				Set(quantity.AsApproximateFloat64())
+		}
+	}
+}
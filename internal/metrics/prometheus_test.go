@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/quickube/QScaler/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestObserveBrokerRequest(t *testing.T) {
+	scalerConfig := &v1alpha1.ScalerConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("scalerconfig-%d", time.Now().UnixNano()), Namespace: "default"},
+		Spec:       v1alpha1.ScalerConfigSpec{Type: "redis"},
+	}
+
+	ObserveBrokerRequest(scalerConfig, GetQueueLengthOperation, time.Now(), nil)
+	ObserveBrokerRequest(scalerConfig, GetQueueLengthOperation, time.Now(), fmt.Errorf("connection refused"))
+
+	errors := brokerRequestErrorsCounter.WithLabelValues("default", scalerConfig.Name, "redis", GetQueueLengthOperation)
+	if count := testutil.ToFloat64(errors); count != 1 {
+		t.Errorf("expected 1 broker error, got %v", count)
+	}
+	if count := testutil.CollectAndCount(brokerRequestDuration, "qscaler_broker_request_duration_seconds"); count == 0 {
+		t.Errorf("expected the broker latency to be observed")
+	}
+
+	DeleteScalerConfigMetrics(types.NamespacedName{Namespace: "default", Name: scalerConfig.Name})
+	if brokerRequestErrorsCounter.DeletePartialMatch(map[string]string{"scalerconfig": scalerConfig.Name}) != 0 {
+		t.Errorf("expected the metrics of the ScalerConfig to be deleted")
+	}
+}
+
+func TestRecordQWorkerMetrics(t *testing.T) {
+	qworker := &v1alpha1.QWorker{
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("qworker-%d", time.Now().UnixNano()), Namespace: "default"},
+		Spec: v1alpha1.QWorkerSpec{
+			PodSpec: corev1.PodSpec{Containers: []corev1.Container{{Name: "worker"}}},
+		},
+		Status: v1alpha1.QWorkerStatus{
+			QueueLength:     12,
+			DesiredReplicas: 4,
+			CurrentReplicas: 3,
+			MaxContainerResourcesUsage: []corev1.ResourceList{{
+				corev1.ResourceCPU:    resource.MustParse("250m"),
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			}},
+		},
+	}
+
+	recordQueueMetrics(qworker)
+	recordVPARecommendations(qworker)
+	RecordCurrentReplicas(qworker)
+	RecordPodCreated(qworker)
+	RecordPodCreated(qworker)
+	RecordPodDrained(qworker)
+
+	tests := []struct {
+		name     string
+		actual   float64
+		expected float64
+	}{
+		{name: "queue length", actual: testutil.ToFloat64(queueLengthGauge.WithLabelValues("default", qworker.Name)), expected: 12},
+		{name: "desired replicas", actual: testutil.ToFloat64(desiredReplicasGauge.WithLabelValues("default", qworker.Name)), expected: 4},
+		{name: "current replicas", actual: testutil.ToFloat64(currentReplicasGauge.WithLabelValues("default", qworker.Name)), expected: 3},
+		{name: "pods created", actual: testutil.ToFloat64(podsCreatedCounter.WithLabelValues("default", qworker.Name)), expected: 2},
+		{name: "pods drained", actual: testutil.ToFloat64(podsDrainedCounter.WithLabelValues("default", qworker.Name)), expected: 1},
+		{name: "cpu request", actual: testutil.ToFloat64(vpaRecommendedRequestsGauge.WithLabelValues("default", qworker.Name, "worker", "cpu")), expected: 0.25},
+		{name: "memory request", actual: testutil.ToFloat64(vpaRecommendedRequestsGauge.WithLabelValues("default", qworker.Name, "worker", "memory")), expected: 64 * 1024 * 1024},
+	}
+	for _, tt := range tests {
+		if tt.actual != tt.expected {
+			t.Errorf("expected %s to be %v, got %v", tt.name, tt.expected, tt.actual)
+		}
+	}
+
+	DeleteQWorkerMetrics(types.NamespacedName{Namespace: "default", Name: qworker.Name})
+	if queueLengthGauge.DeletePartialMatch(map[string]string{"qworker": qworker.Name}) != 0 ||
+		vpaRecommendedRequestsGauge.DeletePartialMatch(map[string]string{"qworker": qworker.Name}) != 0 {
+		t.Errorf("expected the metrics of the QWorker to be deleted")
+	}
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var (
+	defaultRateWindow = 60 * time.Second
+)
+
+// queueSample is a single queue length observation of a QWorker
+type queueSample struct {
+	timestamp   time.Time
+	queueLength int
+	replicas    int
+}
+
+// queueRates are the estimated message rates of a queue, in messages per second
+type queueRates struct {
+	enqueue float64
+	drain   float64
+}
+
+// queueHistory keeps a time series of queue length samples per QWorker
+type queueHistory struct {
+	mu      sync.Mutex
+	samples map[types.NamespacedName][]queueSample
+}
+
+func newQueueHistory() *queueHistory {
+	return &queueHistory{
+		samples: make(map[types.NamespacedName][]queueSample),
+	}
+}
+
+// Record stores a sample and drops the ones that fell out of the window.
+// The last sample before the window start is kept so the whole window has a baseline.
+func (h *queueHistory) Record(key types.NamespacedName, sample queueSample, window time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := append(h.samples[key], sample)
+	windowStart := sample.timestamp.Add(-window)
+	first := 0
+	for first < len(samples)-1 && !samples[first+1].timestamp.After(windowStart) {
+		first++
+	}
+	h.samples[key] = samples[first:]
+}
+
+// Rates estimates the enqueue and drain rates over the recorded samples.
+// The queue length only reveals the net change between two samples, so while a backlog
+// exists workers are assumed to drain at their declared throughput, and the enqueue rate
+// is whatever makes up the difference. Without a declared throughput, only the net
+// growth and shrinkage of the queue are accounted for.
+func (h *queueHistory) Rates(key types.NamespacedName, throughputPerReplica float64) queueRates {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := h.samples[key]
+	if len(samples) < 2 {
+		return queueRates{}
+	}
+
+	var enqueued, drained float64
+	for i := 1; i < len(samples); i++ {
+		previous, current := samples[i-1], samples[i]
+		elapsed := current.timestamp.Sub(previous.timestamp).Seconds()
+		delta := float64(current.queueLength - previous.queueLength)
+
+		intervalDrained := max(0, -delta)
+		if previous.queueLength > 0 || current.queueLength > 0 {
+			intervalDrained = max(intervalDrained, float64(previous.replicas)*throughputPerReplica*elapsed)
+		}
+		drained += intervalDrained
+		enqueued += max(0, delta+intervalDrained)
+	}
+
+	elapsed := samples[len(samples)-1].timestamp.Sub(samples[0].timestamp).Seconds()
+	if elapsed <= 0 {
+		return queueRates{}
+	}
+	return queueRates{
+		enqueue: enqueued / elapsed,
+		drain:   drained / elapsed,
+	}
+}
+
+// Retain drops the history of every QWorker that is not in keys
+func (h *queueHistory) Retain(keys map[types.NamespacedName]struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for key := range h.samples {
+		if _, ok := keys[key]; !ok {
+			delete(h.samples, key)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestQueueHistory_Record(t *testing.T) {
+	key := types.NamespacedName{Namespace: "default", Name: "qworker"}
+	history := newQueueHistory()
+	start := time.Now()
+
+	for i := range 10 {
+		history.Record(key, queueSample{timestamp: start.Add(time.Duration(i) * 10 * time.Second), queueLength: i}, 30*time.Second)
+	}
+
+	// samples at 60s, 70s, 80s and 90s: the window starts at 60s
+	samples := history.samples[key]
+	if len(samples) != 4 {
+		t.Fatalf("expected 4 samples, got %d", len(samples))
+	}
+	if samples[0].queueLength != 6 {
+		t.Errorf("expected the oldest sample to be the window baseline, got queue length %d", samples[0].queueLength)
+	}
+
+	history.Retain(map[types.NamespacedName]struct{}{})
+	if len(history.samples) != 0 {
+		t.Errorf("expected history of removed QWorkers to be dropped")
+	}
+}
+
+func TestQueueHistory_Rates(t *testing.T) {
+	tests := []struct {
+		name            string
+		queueLengths    []int
+		replicas        int
+		throughput      float64
+		expectedEnqueue float64
+		expectedDrain   float64
+	}{
+		{
+			name:            "Not enough samples",
+			queueLengths:    []int{10},
+			replicas:        1,
+			throughput:      1,
+			expectedEnqueue: 0,
+			expectedDrain:   0,
+		},
+		{
+			name:            "Growing queue without declared throughput",
+			queueLengths:    []int{0, 10, 20},
+			replicas:        1,
+			expectedEnqueue: 1,
+			expectedDrain:   0,
+		},
+		{
+			name:            "Shrinking queue without declared throughput",
+			queueLengths:    []int{20, 10, 0},
+			replicas:        1,
+			expectedEnqueue: 0,
+			expectedDrain:   1,
+		},
+		{
+			name:            "Steady backlog is drained at the declared throughput",
+			queueLengths:    []int{50, 50, 50},
+			replicas:        2,
+			throughput:      0.5,
+			expectedEnqueue: 1,
+			expectedDrain:   1,
+		},
+		{
+			name:            "Idle queue",
+			queueLengths:    []int{0, 0, 0},
+			replicas:        2,
+			throughput:      0.5,
+			expectedEnqueue: 0,
+			expectedDrain:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := types.NamespacedName{Namespace: "default", Name: "qworker"}
+			history := newQueueHistory()
+			start := time.Now()
+			for i, queueLength := range tt.queueLengths {
+				history.Record(key, queueSample{
+					timestamp:   start.Add(time.Duration(i) * 10 * time.Second),
+					queueLength: queueLength,
+					replicas:    tt.replicas,
+				}, time.Minute)
+			}
+
+			rates := history.Rates(key, tt.throughput)
+			if math.Abs(rates.enqueue-tt.expectedEnqueue) > 1e-9 || math.Abs(rates.drain-tt.expectedDrain) > 1e-9 {
+				t.Errorf("expected enqueue %v and drain %v, got %v and %v",
+					tt.expectedEnqueue, tt.expectedDrain, rates.enqueue, rates.drain)
+			}
+		})
+	}
+}
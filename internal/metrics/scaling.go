@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recommendedReplicas computes the amount of workers a QWorker needs to keep up with its queue,
+// regardless of its replica bounds
+func recommendedReplicas(scaleConfig v1alpha1.QWorkerScaleConfig, queueLength int, rates queueRates) (int, error) {
+	var desired int
+	switch scaleConfig.ScalingMode {
+	case v1alpha1.RateScalingMode:
+		throughput := throughputPerReplica(scaleConfig)
+		if throughput <= 0 {
+			return 0, fmt.Errorf("scaling mode %s requires a positive throughputPerReplica", v1alpha1.RateScalingMode)
+		}
+		// enough workers to absorb the expected arrivals and clear the backlog within one window
+		window := rateWindow(scaleConfig).Seconds()
+		desired = int(math.Ceil((rates.enqueue*window + float64(queueLength)) / (throughput * window)))
+	default:
+		if scaleConfig.TargetQueueLengthPerReplica == nil {
+			desired = queueLength * scalingFactor(scaleConfig)
+			break
+		}
+		// in milli units to round up exactly, e.g. 3 messages at 0.1 per replica are 30 replicas
+		target := scaleConfig.TargetQueueLengthPerReplica.MilliValue()
+		if target <= 0 {
+			return 0, fmt.Errorf("targetQueueLengthPerReplica must be positive")
+		}
+		desired = int((int64(queueLength)*1000 + target - 1) / target)
+	}
+	return desired, nil
+}
+
+// limitReplicas keeps the recommended replicas of a QWorker within its min and max replicas and the
+// number of consumers its queue supports, and reports whether they were limited in the ScalingLimited condition
+func limitReplicas(qworker *v1alpha1.QWorker, recommended int, maxConsumers int) int {
+	scaleConfig := qworker.Spec.ScaleConfig
+	desired := min(max(recommended, scaleConfig.MinReplicas), scaleConfig.MaxReplicas)
+
+	switch {
+	case maxConsumers > 0 && desired > maxConsumers:
+		desired = maxConsumers
+		qworker.SetCondition(v1alpha1.ScalingLimitedCondition, metav1.ConditionTrue, "TooManyConsumers",
+			fmt.Sprintf("the desired replicas are limited to the %d consumers the queue supports", maxConsumers))
+	case recommended > scaleConfig.MaxReplicas:
+		qworker.SetCondition(v1alpha1.ScalingLimitedCondition, metav1.ConditionTrue, "TooManyReplicas",
+			fmt.Sprintf("the desired replicas are limited to maxReplicas %d", scaleConfig.MaxReplicas))
+	case recommended < scaleConfig.MinReplicas:
+		qworker.SetCondition(v1alpha1.ScalingLimitedCondition, metav1.ConditionTrue, "TooFewReplicas",
+			fmt.Sprintf("the desired replicas are raised to minReplicas %d", scaleConfig.MinReplicas))
+	default:
+		qworker.SetCondition(v1alpha1.ScalingLimitedCondition, metav1.ConditionFalse, "DesiredWithinRange",
+			"the desired replicas are within the acceptable range")
+	}
+	return desired
+}
+
+// applyActivation keeps QWorkers without minimum replicas at zero until their queue exceeds
+// the activation threshold, and returns them to zero once it has been idle for the idle period.
+// It records the activity of the QWorker in its status and returns the adjusted desired replicas.
+func applyActivation(qworker *v1alpha1.QWorker, queueLength int, rates queueRates, desired int, now time.Time) int {
+	scaleConfig := qworker.Spec.ScaleConfig
+	idle := queueLength == 0 && rates.enqueue <= 0
+	if !idle {
+		qworker.Status.LastActiveTime = &metav1.Time{Time: now}
+	}
+
+	if scaleConfig.MinReplicas > 0 {
+		qworker.Status.Active = true
+		return desired
+	}
+
+	if !qworker.Status.Active {
+		if queueLength <= scaleConfig.ActivationThreshold {
+			return 0
+		}
+		qworker.Status.Active = true
+	} else if idle {
+		idlePeriod := time.Duration(scaleConfig.IdlePeriodSeconds) * time.Second
+		if qworker.Status.LastActiveTime == nil || !now.Before(qworker.Status.LastActiveTime.Add(idlePeriod)) {
+			qworker.Status.Active = false
+			return 0
+		}
+	}
+	// an active QWorker keeps a worker through the idle period
+	return max(desired, min(1, scaleConfig.MaxReplicas))
+}
+
+// applyManualReplicas pins the desired replicas of a QWorker to spec.replicas until its TTL passes, and records
+// the override in its status and ManualOverride condition. It returns the desired replicas and whether the
+// override expired, in which case spec.replicas should be cleared.
+func applyManualReplicas(qworker *v1alpha1.QWorker, desired int, now time.Time) (int, bool) {
+	manualReplicas := qworker.Spec.Replicas
+	if manualReplicas == nil {
+		qworker.Status.ManualReplicas = nil
+		qworker.Status.ManualReplicasTime = nil
+		qworker.SetCondition(v1alpha1.ManualOverrideCondition, metav1.ConditionFalse, "MetricsDriven",
+			"the desired replicas are computed from the queue")
+		return desired, false
+	}
+
+	// the TTL restarts whenever spec.replicas changes
+	if qworker.Status.ManualReplicas == nil || *qworker.Status.ManualReplicas != *manualReplicas || qworker.Status.ManualReplicasTime == nil {
+		replicas := *manualReplicas
+		qworker.Status.ManualReplicas = &replicas
+		qworker.Status.ManualReplicasTime = &metav1.Time{Time: now}
+	}
+
+	ttl := qworker.Spec.ManualReplicasTTLSeconds
+	if ttl != nil && !now.Before(qworker.Status.ManualReplicasTime.Add(time.Duration(*ttl)*time.Second)) {
+		qworker.Status.ManualReplicas = nil
+		qworker.Status.ManualReplicasTime = nil
+		qworker.SetCondition(v1alpha1.ManualOverrideCondition, metav1.ConditionFalse, "Expired",
+			fmt.Sprintf("spec.replicas %d expired after %d seconds", *manualReplicas, *ttl))
+		return desired, true
+	}
+	qworker.SetCondition(v1alpha1.ManualOverrideCondition, metav1.ConditionTrue, "ReplicasPinned",
+		fmt.Sprintf("the desired replicas are pinned to spec.replicas %d", *manualReplicas))
+	return *manualReplicas, false
+}
+
+// applyFallback returns the desired replicas of a QWorker whose queue could not be polled, given its number of
+// consecutive failed polls. Its last desired replicas are kept until the failure threshold of its fallback is
+// reached, and replaced by the fallback replicas from then on. The mode is recorded in its Fallback condition.
+func applyFallback(qworker *v1alpha1.QWorker, failures int) int {
+	scaleConfig := qworker.Spec.ScaleConfig
+	fallback := scaleConfig.Fallback
+	if fallback == nil {
+		qworker.SetCondition(v1alpha1.FallbackCondition, metav1.ConditionFalse, "LastKnownReplicas",
+			fmt.Sprintf("the last desired replicas %d are kept after %d failed polls", qworker.Status.DesiredReplicas, failures))
+		return qworker.Status.DesiredReplicas
+	}
+
+	threshold := fallback.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFallbackFailureThreshold
+	}
+	if failures < threshold {
+		qworker.SetCondition(v1alpha1.FallbackCondition, metav1.ConditionFalse, "LastKnownReplicas",
+			fmt.Sprintf("the last desired replicas %d are kept after %d of %d failed polls",
+				qworker.Status.DesiredReplicas, failures, threshold))
+		return qworker.Status.DesiredReplicas
+	}
+
+	desired := min(max(fallback.Replicas, scaleConfig.MinReplicas), scaleConfig.MaxReplicas)
+	qworker.SetCondition(v1alpha1.FallbackCondition, metav1.ConditionTrue, "FallbackReplicas",
+		fmt.Sprintf("the desired replicas are set to the fallback replicas %d after %d failed polls", desired, failures))
+	return desired
+}
+
+// scalingFactor returns the replicas per message of a QWorker, 1 when it is not set
+func scalingFactor(scaleConfig v1alpha1.QWorkerScaleConfig) int {
+	if scaleConfig.ScalingFactor == nil {
+		return 1
+	}
+	return *scaleConfig.ScalingFactor
+}
+
+func throughputPerReplica(scaleConfig v1alpha1.QWorkerScaleConfig) float64 {
+	if scaleConfig.ThroughputPerReplica == nil {
+		return 0
+	}
+	return scaleConfig.ThroughputPerReplica.AsApproximateFloat64()
+}
+
+func rateWindow(scaleConfig v1alpha1.QWorkerScaleConfig) time.Duration {
+	if scaleConfig.RateWindowSeconds <= 0 {
+		return defaultRateWindow
+	}
+	return time.Duration(scaleConfig.RateWindowSeconds) * time.Second
+}
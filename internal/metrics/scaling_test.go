@@ -0,0 +1,338 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestDesiredReplicas(t *testing.T) {
+	halfMessagePerSecond := resource.MustParse("500m")
+
+	tests := []struct {
+		name          string
+		scaleConfig   v1alpha1.QWorkerScaleConfig
+		queueLength   int
+		rates         queueRates
+		expected      int
+		expectedError bool
+	}{
+		{
+			name:        "Queue length multiplied by the scaling factor",
+			scaleConfig: v1alpha1.QWorkerScaleConfig{MinReplicas: 1, MaxReplicas: 10, ScalingFactor: ptr.To(2)},
+			queueLength: 3,
+			expected:    6,
+		},
+		{
+			name:        "Capped at max replicas",
+			scaleConfig: v1alpha1.QWorkerScaleConfig{MinReplicas: 1, MaxReplicas: 10, ScalingFactor: ptr.To(1)},
+			queueLength: 30,
+			expected:    10,
+		},
+		{
+			name:        "One replica per message without a scaling factor",
+			scaleConfig: v1alpha1.QWorkerScaleConfig{MinReplicas: 1, MaxReplicas: 10},
+			queueLength: 3,
+			expected:    3,
+		},
+		{
+			name:        "Held at min replicas by a scaling factor of 0",
+			scaleConfig: v1alpha1.QWorkerScaleConfig{MinReplicas: 2, MaxReplicas: 10, ScalingFactor: ptr.To(0)},
+			queueLength: 30,
+			expected:    2,
+		},
+		{
+			name:        "Raised to min replicas",
+			scaleConfig: v1alpha1.QWorkerScaleConfig{MinReplicas: 2, MaxReplicas: 10, ScalingFactor: ptr.To(1)},
+			queueLength: 0,
+			expected:    2,
+		},
+		{
+			name: "One replica per target queue length, rounded up",
+			scaleConfig: v1alpha1.QWorkerScaleConfig{
+				MinReplicas:                 0,
+				MaxReplicas:                 10,
+				ScalingFactor:               ptr.To(1),
+				TargetQueueLengthPerReplica: resource.NewQuantity(50, resource.DecimalSI),
+			},
+			queueLength: 101,
+			expected:    3,
+		},
+		{
+			name: "Fractional target queue length",
+			scaleConfig: v1alpha1.QWorkerScaleConfig{
+				MinReplicas:                 0,
+				MaxReplicas:                 100,
+				TargetQueueLengthPerReplica: resource.NewMilliQuantity(100, resource.DecimalSI),
+			},
+			queueLength: 3,
+			expected:    30,
+		},
+		{
+			name: "Zero target queue length",
+			scaleConfig: v1alpha1.QWorkerScaleConfig{
+				MaxReplicas:                 10,
+				TargetQueueLengthPerReplica: resource.NewQuantity(0, resource.DecimalSI),
+			},
+			expectedError: true,
+		},
+		{
+			name: "Rate mode sizes for arrivals and backlog",
+			scaleConfig: v1alpha1.QWorkerScaleConfig{
+				MinReplicas:          0,
+				MaxReplicas:          100,
+				ScalingMode:          v1alpha1.RateScalingMode,
+				ThroughputPerReplica: &halfMessagePerSecond,
+				RateWindowSeconds:    60,
+			},
+			// 2 msg/s arriving need 4 workers, 60 messages of backlog need 2 more to clear within a minute
+			queueLength: 60,
+			rates:       queueRates{enqueue: 2},
+			expected:    6,
+		},
+		{
+			name: "Rate mode scales before a backlog builds up",
+			scaleConfig: v1alpha1.QWorkerScaleConfig{
+				MinReplicas:          0,
+				MaxReplicas:          100,
+				ScalingMode:          v1alpha1.RateScalingMode,
+				ThroughputPerReplica: &halfMessagePerSecond,
+			},
+			queueLength: 0,
+			rates:       queueRates{enqueue: 1.1},
+			expected:    3,
+		},
+		{
+			name: "Rate mode without throughput",
+			scaleConfig: v1alpha1.QWorkerScaleConfig{
+				MaxReplicas: 10,
+				ScalingMode: v1alpha1.RateScalingMode,
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recommended, err := recommendedReplicas(tt.scaleConfig, tt.queueLength, tt.rates)
+			if (err != nil) != tt.expectedError {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			actual := limitReplicas(&v1alpha1.QWorker{Spec: v1alpha1.QWorkerSpec{ScaleConfig: tt.scaleConfig}}, recommended, 0)
+			if actual != tt.expected {
+				t.Errorf("expected %d desired replicas, got %d", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestApplyActivation(t *testing.T) {
+	now := time.Now()
+	scaleToZero := v1alpha1.QWorkerScaleConfig{MinReplicas: 0, MaxReplicas: 10, ActivationThreshold: 5, IdlePeriodSeconds: 60}
+
+	tests := []struct {
+		name           string
+		scaleConfig    v1alpha1.QWorkerScaleConfig
+		status         v1alpha1.QWorkerStatus
+		queueLength    int
+		rates          queueRates
+		desired        int
+		expected       int
+		expectedActive bool
+	}{
+		{
+			name:           "Min replicas are always active",
+			scaleConfig:    v1alpha1.QWorkerScaleConfig{MinReplicas: 1, MaxReplicas: 10},
+			desired:        1,
+			expected:       1,
+			expectedActive: true,
+		},
+		{
+			name:           "Stays at zero up to the activation threshold",
+			scaleConfig:    scaleToZero,
+			queueLength:    5,
+			desired:        5,
+			expected:       0,
+			expectedActive: false,
+		},
+		{
+			name:           "Activates above the activation threshold",
+			scaleConfig:    scaleToZero,
+			queueLength:    6,
+			desired:        6,
+			expected:       6,
+			expectedActive: true,
+		},
+		{
+			name:           "Keeps a worker while idle within the idle period",
+			scaleConfig:    scaleToZero,
+			status:         v1alpha1.QWorkerStatus{Active: true, LastActiveTime: &metav1.Time{Time: now.Add(-30 * time.Second)}},
+			queueLength:    0,
+			desired:        0,
+			expected:       1,
+			expectedActive: true,
+		},
+		{
+			name:           "Stays active below the activation threshold",
+			scaleConfig:    scaleToZero,
+			status:         v1alpha1.QWorkerStatus{Active: true, LastActiveTime: &metav1.Time{Time: now.Add(-time.Hour)}},
+			queueLength:    2,
+			desired:        2,
+			expected:       2,
+			expectedActive: true,
+		},
+		{
+			name:           "Messages still arriving keep the QWorker active",
+			scaleConfig:    scaleToZero,
+			status:         v1alpha1.QWorkerStatus{Active: true, LastActiveTime: &metav1.Time{Time: now.Add(-time.Hour)}},
+			queueLength:    0,
+			rates:          queueRates{enqueue: 1},
+			desired:        0,
+			expected:       1,
+			expectedActive: true,
+		},
+		{
+			name:           "Scales to zero after the idle period",
+			scaleConfig:    scaleToZero,
+			status:         v1alpha1.QWorkerStatus{Active: true, LastActiveTime: &metav1.Time{Time: now.Add(-time.Minute)}},
+			queueLength:    0,
+			desired:        0,
+			expected:       0,
+			expectedActive: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qworker := &v1alpha1.QWorker{
+				Spec:   v1alpha1.QWorkerSpec{ScaleConfig: tt.scaleConfig},
+				Status: tt.status,
+			}
+			actual := applyActivation(qworker, tt.queueLength, tt.rates, tt.desired, now)
+			if actual != tt.expected {
+				t.Errorf("expected %d desired replicas, got %d", tt.expected, actual)
+			}
+			if qworker.Status.Active != tt.expectedActive {
+				t.Errorf("expected active %v, got %v", tt.expectedActive, qworker.Status.Active)
+			}
+			if (tt.queueLength > 0 || tt.rates.enqueue > 0) && !qworker.Status.LastActiveTime.Equal(&metav1.Time{Time: now}) {
+				t.Errorf("expected last active time to be updated, got %v", qworker.Status.LastActiveTime)
+			}
+		})
+	}
+}
+
+func TestLimitReplicas(t *testing.T) {
+	tests := []struct {
+		name           string
+		recommended    int
+		maxConsumers   int
+		expected       int
+		expectedStatus metav1.ConditionStatus
+		expectedReason string
+	}{
+		{name: "Within range", recommended: 5, expected: 5, expectedStatus: metav1.ConditionFalse, expectedReason: "DesiredWithinRange"},
+		{name: "Above max replicas", recommended: 20, expected: 10, expectedStatus: metav1.ConditionTrue, expectedReason: "TooManyReplicas"},
+		{name: "Below min replicas", recommended: 0, expected: 2, expectedStatus: metav1.ConditionTrue, expectedReason: "TooFewReplicas"},
+		{name: "Above the consumers of the queue", recommended: 8, maxConsumers: 6, expected: 6, expectedStatus: metav1.ConditionTrue, expectedReason: "TooManyConsumers"},
+		{name: "Within the consumers of the queue", recommended: 4, maxConsumers: 6, expected: 4, expectedStatus: metav1.ConditionFalse, expectedReason: "DesiredWithinRange"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qworker := &v1alpha1.QWorker{
+				Spec: v1alpha1.QWorkerSpec{ScaleConfig: v1alpha1.QWorkerScaleConfig{MinReplicas: 2, MaxReplicas: 10}},
+			}
+			actual := limitReplicas(qworker, tt.recommended, tt.maxConsumers)
+			if actual != tt.expected {
+				t.Errorf("expected %d desired replicas, got %d", tt.expected, actual)
+			}
+			condition := qworker.Status.Conditions[0]
+			if condition.Type != v1alpha1.ScalingLimitedCondition || condition.Status != tt.expectedStatus || condition.Reason != tt.expectedReason {
+				t.Errorf("expected condition %s %s %s, got %v", v1alpha1.ScalingLimitedCondition, tt.expectedStatus, tt.expectedReason, condition)
+			}
+		})
+	}
+}
+
+func TestApplyManualReplicas(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name            string
+		spec            v1alpha1.QWorkerSpec
+		status          v1alpha1.QWorkerStatus
+		expected        int
+		expectedExpired bool
+		expectedPinned  bool
+	}{
+		{
+			name:     "Follows the queue without spec.replicas",
+			status:   v1alpha1.QWorkerStatus{ManualReplicas: ptr.To(3), ManualReplicasTime: &metav1.Time{Time: now}},
+			expected: 5,
+		},
+		{
+			name:           "Pins the desired replicas to spec.replicas",
+			spec:           v1alpha1.QWorkerSpec{Replicas: ptr.To(8)},
+			expected:       8,
+			expectedPinned: true,
+		},
+		{
+			name: "Pins the desired replicas within the TTL",
+			spec: v1alpha1.QWorkerSpec{Replicas: ptr.To(8), ManualReplicasTTLSeconds: ptr.To(600)},
+			status: v1alpha1.QWorkerStatus{
+				ManualReplicas:     ptr.To(8),
+				ManualReplicasTime: &metav1.Time{Time: now.Add(-5 * time.Minute)},
+			},
+			expected:       8,
+			expectedPinned: true,
+		},
+		{
+			name: "Expires after the TTL",
+			spec: v1alpha1.QWorkerSpec{Replicas: ptr.To(8), ManualReplicasTTLSeconds: ptr.To(600)},
+			status: v1alpha1.QWorkerStatus{
+				ManualReplicas:     ptr.To(8),
+				ManualReplicasTime: &metav1.Time{Time: now.Add(-15 * time.Minute)},
+			},
+			expected:        5,
+			expectedExpired: true,
+		},
+		{
+			name: "Restarts the TTL when spec.replicas changes",
+			spec: v1alpha1.QWorkerSpec{Replicas: ptr.To(2), ManualReplicasTTLSeconds: ptr.To(600)},
+			status: v1alpha1.QWorkerStatus{
+				ManualReplicas:     ptr.To(8),
+				ManualReplicasTime: &metav1.Time{Time: now.Add(-15 * time.Minute)},
+			},
+			expected:       2,
+			expectedPinned: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qworker := &v1alpha1.QWorker{Spec: tt.spec, Status: tt.status}
+			actual, expired := applyManualReplicas(qworker, 5, now)
+			if actual != tt.expected {
+				t.Errorf("expected %d desired replicas, got %d", tt.expected, actual)
+			}
+			if expired != tt.expectedExpired {
+				t.Errorf("expected expired to be %v, got %v", tt.expectedExpired, expired)
+			}
+			if pinned := meta.IsStatusConditionTrue(qworker.Status.Conditions, v1alpha1.ManualOverrideCondition); pinned != tt.expectedPinned {
+				t.Errorf("expected the ManualOverride condition to be %v, got %v", tt.expectedPinned, qworker.Status.Conditions)
+			}
+			if (qworker.Status.ManualReplicas != nil) != tt.expectedPinned {
+				t.Errorf("expected the manual replicas to be recorded only while pinned, got %v", qworker.Status.ManualReplicas)
+			}
+		})
+	}
+}
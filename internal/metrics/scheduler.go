@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// pollScheduler polls every QWorker on its own interval, with a bounded number of polls running at once.
+// A QWorker is never polled twice at the same time, so a slow broker only holds up its own QWorkers.
+type pollScheduler struct {
+	mu        sync.Mutex
+	nextPolls map[types.NamespacedName]time.Time
+	polling   map[types.NamespacedName]struct{}
+
+	workers chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newPollScheduler(maxConcurrentPolls int) *pollScheduler {
+	return &pollScheduler{
+		nextPolls: make(map[types.NamespacedName]time.Time),
+		polling:   make(map[types.NamespacedName]struct{}),
+		workers:   make(chan struct{}, max(1, maxConcurrentPolls)),
+	}
+}
+
+// Schedule starts poll in the background if the QWorker is due and a worker is free, and returns
+// whether it did. A QWorker that is skipped stays due and is picked up by a later call.
+func (p *pollScheduler) Schedule(key types.NamespacedName, now time.Time, interval time.Duration, poll func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.polling[key]; ok {
+		return false
+	}
+	if nextPoll, ok := p.nextPolls[key]; ok && now.Before(nextPoll) {
+		return false
+	}
+
+	select {
+	case p.workers <- struct{}{}:
+	default:
+		return false
+	}
+
+	p.polling[key] = struct{}{}
+	p.nextPolls[key] = now.Add(interval)
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			delete(p.polling, key)
+			p.mu.Unlock()
+			<-p.workers
+			p.wg.Done()
+		}()
+		poll()
+	}()
+	return true
+}
+
+// Wait blocks until every started poll has returned
+func (p *pollScheduler) Wait() {
+	p.wg.Wait()
+}
+
+// Retain drops the schedule of every QWorker that is not in keys
+func (p *pollScheduler) Retain(keys map[types.NamespacedName]struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key := range p.nextPolls {
+		if _, ok := keys[key]; !ok {
+			delete(p.nextPolls, key)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestPollScheduler_Schedule(t *testing.T) {
+	scheduler := newPollScheduler(2)
+	key := types.NamespacedName{Namespace: "default", Name: "qworker"}
+	now := time.Now()
+	var polls atomic.Int32
+	poll := func() { polls.Add(1) }
+
+	if !scheduler.Schedule(key, now, 10*time.Second, poll) {
+		t.Fatalf("expected the first poll to be scheduled")
+	}
+	scheduler.Wait()
+
+	if scheduler.Schedule(key, now.Add(5*time.Second), 10*time.Second, poll) {
+		t.Errorf("expected no poll before the interval passed")
+	}
+	if !scheduler.Schedule(key, now.Add(10*time.Second), 10*time.Second, poll) {
+		t.Errorf("expected a poll once the interval passed")
+	}
+	scheduler.Wait()
+
+	if polls.Load() != 2 {
+		t.Errorf("expected 2 polls, got %d", polls.Load())
+	}
+}
+
+func TestPollScheduler_Concurrency(t *testing.T) {
+	scheduler := newPollScheduler(2)
+	now := time.Now()
+	release := make(chan struct{})
+	blockingPoll := func() { <-release }
+
+	slow := types.NamespacedName{Namespace: "default", Name: "slow"}
+	if !scheduler.Schedule(slow, now, time.Second, blockingPoll) {
+		t.Fatalf("expected the slow poll to be scheduled")
+	}
+	if scheduler.Schedule(slow, now.Add(time.Hour), time.Second, blockingPoll) {
+		t.Errorf("expected a QWorker not to be polled while its previous poll runs")
+	}
+
+	other := types.NamespacedName{Namespace: "default", Name: "other"}
+	if !scheduler.Schedule(other, now, time.Second, blockingPoll) {
+		t.Fatalf("expected another QWorker to be polled alongside the slow one")
+	}
+
+	third := types.NamespacedName{Namespace: "default", Name: "third"}
+	if scheduler.Schedule(third, now, time.Second, blockingPoll) {
+		t.Errorf("expected no more polls than workers")
+	}
+
+	close(release)
+	scheduler.Wait()
+	if !scheduler.Schedule(third, now, time.Second, func() {}) {
+		t.Errorf("expected a skipped QWorker to be polled once a worker is free")
+	}
+	scheduler.Wait()
+}
+
+func TestPollScheduler_Retain(t *testing.T) {
+	scheduler := newPollScheduler(1)
+	key := types.NamespacedName{Namespace: "default", Name: "qworker"}
+	now := time.Now()
+
+	scheduler.Schedule(key, now, time.Hour, func() {})
+	scheduler.Wait()
+	scheduler.Retain(map[types.NamespacedName]struct{}{})
+
+	if !scheduler.Schedule(key, now, time.Hour, func() {}) {
+		t.Errorf("expected a recreated QWorker to be polled right away")
+	}
+	scheduler.Wait()
+}
@@ -3,13 +3,16 @@ package metrics
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/quickube/QScaler/api/v1alpha1"
 	"github.com/quickube/QScaler/internal/brokers"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 	metricsv1beta1client "k8s.io/metrics/pkg/client/clientset/versioned/typed/metrics/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -25,60 +28,209 @@ type MetricsServer struct {
 	qworkers      *v1alpha1.QWorkerList
 	Scheme        *runtime.Scheme
 	metricsClient metricsv1beta1client.MetricsV1beta1Interface
+	queueHistory  *queueHistory
+
+	scheduler       *pollScheduler
+	pollingInterval time.Duration
+	pollTimeout     time.Duration
 }
 
 func (s *MetricsServer) Run(ctx context.Context) error {
-	log.Log.Info("Starting QScaler Metrics Server")
-
-	var BrokerClient brokers.Broker
-	var QueueLength int
-	var err error
+	log.Log.V(1).Info("running QScaler Metrics Server")
 
-	err = s.Sync(ctx)
+	err := s.Sync(ctx)
 	if err != nil {
 		return err
 	}
 
 	if len(s.qworkers.Items) == 0 {
-		log.Log.Info("No qworkers found!")
+		log.Log.V(1).Info("No qworkers found!")
 		return nil
 	}
+	if s.scheduler == nil {
+		s.scheduler = newPollScheduler(defaultMaxConcurrentPolls)
+	}
+
+	now := time.Now()
 	for _, qworker := range s.qworkers.Items {
-		var scalerConfig v1alpha1.ScalerConfig
-		namespacedName := client.ObjectKey{Name: qworker.Spec.ScaleConfig.ScalerConfigRef, Namespace: qworker.ObjectMeta.Namespace}
-		if err = s.client.Get(ctx, namespacedName, &scalerConfig); err != nil {
-			log.Log.Error(err, "Failed to get ScalerConfig", "namespacedName", namespacedName.String())
-		}
+		key := types.NamespacedName{Namespace: qworker.Namespace, Name: qworker.Name}
+		s.scheduler.Schedule(key, now, s.qworkerPollingInterval(qworker), func() {
+			s.pollQWorker(ctx, qworker)
+		})
+	}
+	return nil
+}
+
+// pollQWorker reads the queue of a QWorker and updates its desired replicas
+func (s *MetricsServer) pollQWorker(ctx context.Context, qworker v1alpha1.QWorker) {
+	var BrokerClient brokers.Broker
+	var QueueLength int
+	var desiredPodsAmount int
+	var err error
+
+	pollTimeout := s.pollTimeout
+	if pollTimeout <= 0 {
+		pollTimeout = defaultPollTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, pollTimeout)
+	defer cancel()
+
+	var scalerConfig v1alpha1.ScalerConfig
+	namespacedName := client.ObjectKey{Name: qworker.Spec.ScaleConfig.ScalerConfigRef, Namespace: qworker.ObjectMeta.Namespace}
+	if err = s.client.Get(ctx, namespacedName, &scalerConfig); err != nil {
+		log.Log.Error(err, "Failed to get ScalerConfig", "namespacedName", namespacedName.String())
+		s.failPoll(ctx, &qworker, v1alpha1.ScalerConfigResolvedCondition, "FailedGetScalerConfig", err)
+		return
+	}
+
+	BrokerClient, err = brokers.GetOrCreateBroker(&scalerConfig)
+	if err != nil {
+		log.Log.Error(err, "Failed to create broker client")
+		s.failPoll(ctx, &qworker, v1alpha1.ScalerConfigResolvedCondition, "FailedCreateBroker", err)
+		return
+	}
+	qworker.SetCondition(v1alpha1.ScalerConfigResolvedCondition, v1.ConditionTrue, "BrokerCreated",
+		fmt.Sprintf("the %s broker of ScalerConfig %s was created", scalerConfig.Spec.Type, scalerConfig.Name))
+
+	start := time.Now()
+	QueueLength, err = BrokerClient.GetQueueLength(&ctx, qworker.Spec.ScaleConfig.Queue)
+	ObserveBrokerRequest(&scalerConfig, GetQueueLengthOperation, start, err)
+	if err != nil {
+		log.Log.Error(err, "Failed to get queue length")
+		s.failPoll(ctx, &qworker, v1alpha1.BrokerReachableCondition, "FailedGetQueueLength", err)
+		return
+	}
+	qworker.SetCondition(v1alpha1.BrokerReachableCondition, v1.ConditionTrue, "QueueLengthRead",
+		fmt.Sprintf("the length of queue %s was read", qworker.Spec.ScaleConfig.Queue))
+	log.Log.Info(fmt.Sprintf("current queue length: %d", QueueLength))
+
+	rates := s.recordQueueLength(&qworker, QueueLength)
+	qworker.Status.QueueLength = QueueLength
+	qworker.Status.EnqueueRate = rateQuantity(rates.enqueue)
+	qworker.Status.DrainRate = rateQuantity(rates.drain)
+
+	desiredPodsAmount, err = recommendedReplicas(qworker.Spec.ScaleConfig, QueueLength, rates)
+	if err != nil {
+		log.Log.Error(err, "Failed to compute desired replicas", "qworker", qworker.Name)
+		qworker.SetCondition(v1alpha1.ScalingActiveCondition, v1.ConditionFalse, "InvalidScaleConfig", err.Error())
+		// the queue was polled, so the fallback meant for broker outages does not apply
+		qworker.Status.ConsecutiveFailures = 0
+		qworker.SetCondition(v1alpha1.FallbackCondition, v1.ConditionFalse, "LastKnownReplicas",
+			fmt.Sprintf("the last desired replicas %d are kept until the scale config is fixed", qworker.Status.DesiredReplicas))
+		s.keepReplicas(ctx, &qworker, qworker.Status.DesiredReplicas)
+		return
+	}
+	qworker.SetCondition(v1alpha1.ScalingActiveCondition, v1.ConditionTrue, "ValidQueueLength",
+		fmt.Sprintf("the desired replicas are computed from a queue length of %d", QueueLength))
+	qworker.Status.ConsecutiveFailures = 0
+	qworker.SetCondition(v1alpha1.FallbackCondition, v1.ConditionFalse, "QueuePolled",
+		"the desired replicas are computed from the queue")
 
-		BrokerClient, err = brokers.NewBroker(&scalerConfig)
+	maxConsumers := 0
+	if limitedBroker, ok := BrokerClient.(brokers.ConsumerLimitedBroker); ok {
+		start = time.Now()
+		maxConsumers, err = limitedBroker.GetMaxConsumers(&ctx, qworker.Spec.ScaleConfig.Queue)
+		ObserveBrokerRequest(&scalerConfig, GetMaxConsumersOperation, start, err)
 		if err != nil {
-			log.Log.Error(err, "Failed to create broker client")
+			log.Log.Error(err, "Failed to get max consumers of queue", "qworker", qworker.Name)
 		}
+	}
+	desiredPodsAmount = limitReplicas(&qworker, desiredPodsAmount, maxConsumers)
+	now := time.Now()
+	desiredPodsAmount = applyBehavior(&qworker, desiredPodsAmount, now)
+	desiredPodsAmount = applyActivation(&qworker, QueueLength, rates, desiredPodsAmount, now)
+	desiredPodsAmount, overrideExpired := applyManualReplicas(&qworker, desiredPodsAmount, now)
+	recordScaleEvent(&qworker, desiredPodsAmount, now)
+	log.Log.Info(fmt.Sprintf("desired amount: %d", desiredPodsAmount))
+	qworker.Status.DesiredReplicas = desiredPodsAmount
 
-		QueueLength, err = BrokerClient.GetQueueLength(&ctx, qworker.Spec.ScaleConfig.Queue)
+	if qworker.Spec.ScaleConfig.ActivateVPA {
+		err = s.RightSizeContainers(ctx, &qworker)
 		if err != nil {
-			log.Log.Error(err, "Failed to get queue length")
+			log.Log.Error(err, "Failed to right size containers", "qworker", qworker.Name)
+			return
 		}
-		log.Log.Info(fmt.Sprintf("current queue length: %d", QueueLength))
+		recordVPARecommendations(&qworker)
+	}
+	recordQueueMetrics(&qworker)
 
-		desiredPodsAmount := min(
-			max(QueueLength*qworker.Spec.ScaleConfig.ScalingFactor, qworker.Spec.ScaleConfig.MinReplicas),
-			qworker.Spec.ScaleConfig.MaxReplicas)
-		log.Log.Info(fmt.Sprintf("desired amount: %d", desiredPodsAmount))
-		qworker.Status.DesiredReplicas = desiredPodsAmount
+	s.updateStatus(ctx, &qworker, overrideExpired)
+}
 
-		if qworker.Spec.ScaleConfig.ActivateVPA {
-			err = s.RightSizeContainers(ctx, &qworker)
-			if err != nil {
-				return err
-			}
-		}
+// failPoll records why a QWorker could not be polled in its conditions. Its desired replicas are left as they are
+// until its fallback applies, unless they are pinned by spec.replicas.
+func (s *MetricsServer) failPoll(ctx context.Context, qworker *v1alpha1.QWorker, conditionType string, reason string, err error) {
+	qworker.SetCondition(conditionType, v1.ConditionFalse, reason, err.Error())
+	if conditionType != v1alpha1.ScalingActiveCondition {
+		qworker.SetCondition(v1alpha1.ScalingActiveCondition, v1.ConditionFalse, reason,
+			"the desired replicas can not be computed: "+err.Error())
+	}
+	qworker.Status.ConsecutiveFailures++
+	s.keepReplicas(ctx, qworker, applyFallback(qworker, qworker.Status.ConsecutiveFailures))
+}
+
+// keepReplicas writes the desired replicas of a QWorker that were not computed from its queue, unless they are
+// pinned by spec.replicas
+func (s *MetricsServer) keepReplicas(ctx context.Context, qworker *v1alpha1.QWorker, desired int) {
+	now := time.Now()
+	desired, overrideExpired := applyManualReplicas(qworker, desired, now)
+	recordScaleEvent(qworker, desired, now)
+	qworker.Status.DesiredReplicas = desired
+	recordDesiredReplicas(qworker)
+	s.updateStatus(ctx, qworker, overrideExpired)
+}
 
-		if err = s.client.Status().Update(ctx, &qworker); err != nil {
-			log.Log.Error(err, "Failed to update QWorker status")
+// updateStatus writes the status of a polled QWorker, and clears its spec.replicas once the manual override expired
+func (s *MetricsServer) updateStatus(ctx context.Context, qworker *v1alpha1.QWorker, overrideExpired bool) {
+	if err := s.client.Status().Update(ctx, qworker); err != nil {
+		log.Log.Error(err, "Failed to update QWorker status")
+		return
+	}
+	if !overrideExpired {
+		return
+	}
+
+	log.Log.Info("Manual replicas expired", "qworker", qworker.Name)
+	// the patch fails if spec.replicas was set again since the poll read the QWorker, so a new override is kept
+	patch := client.MergeFromWithOptions(qworker.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	qworker.Spec.Replicas = nil
+	if err := s.client.Patch(ctx, qworker, patch); err != nil {
+		if apierrors.IsConflict(err) {
+			log.Log.Info("QWorker changed since it was polled, keeping its manual replicas", "qworker", qworker.Name)
+			return
 		}
+		log.Log.Error(err, "Failed to clear the manual replicas of QWorker", "qworker", qworker.Name)
 	}
-	return nil
+}
+
+// qworkerPollingInterval returns how often the queue of a QWorker is polled
+func (s *MetricsServer) qworkerPollingInterval(qworker v1alpha1.QWorker) time.Duration {
+	if qworker.Spec.ScaleConfig.PollingIntervalSeconds > 0 {
+		return time.Duration(qworker.Spec.ScaleConfig.PollingIntervalSeconds) * time.Second
+	}
+	if s.pollingInterval > 0 {
+		return s.pollingInterval
+	}
+	return defaultPollingInterval
+}
+
+// recordQueueLength adds a queue length sample to the QWorker's history and returns its current rates
+func (s *MetricsServer) recordQueueLength(qworker *v1alpha1.QWorker, queueLength int) queueRates {
+	if s.queueHistory == nil {
+		s.queueHistory = newQueueHistory()
+	}
+
+	key := types.NamespacedName{Namespace: qworker.Namespace, Name: qworker.Name}
+	s.queueHistory.Record(key, queueSample{
+		timestamp:   time.Now(),
+		queueLength: queueLength,
+		replicas:    qworker.Status.CurrentReplicas,
+	}, rateWindow(qworker.Spec.ScaleConfig))
+	return s.queueHistory.Rates(key, throughputPerReplica(qworker.Spec.ScaleConfig))
+}
+
+func rateQuantity(rate float64) *resource.Quantity {
+	return resource.NewMilliQuantity(int64(rate*1000), resource.DecimalSI)
 }
 
 func (s *MetricsServer) RightSizeContainers(ctx context.Context, qworker *v1alpha1.QWorker) error {
@@ -159,6 +311,17 @@ func (s *MetricsServer) Sync(ctx context.Context) error {
 		return err
 	}
 	s.qworkers = qworkerList
-	log.Log.Info("successfully synchronized QWorkers", "count", len(qworkerList.Items))
+
+	existing := make(map[types.NamespacedName]struct{}, len(qworkerList.Items))
+	for _, qworker := range qworkerList.Items {
+		existing[types.NamespacedName{Namespace: qworker.Namespace, Name: qworker.Name}] = struct{}{}
+	}
+	if s.queueHistory != nil {
+		s.queueHistory.Retain(existing)
+	}
+	if s.scheduler != nil {
+		s.scheduler.Retain(existing)
+	}
+	log.Log.V(1).Info("successfully synchronized QWorkers", "count", len(qworkerList.Items))
 	return nil
 }
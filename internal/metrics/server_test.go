@@ -6,20 +6,24 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/quickube/QScaler/api/v1alpha1"
 	"github.com/quickube/QScaler/internal/brokers"
 	"github.com/quickube/QScaler/internal/mocks"
 	assertion "github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	k8stesting "k8s.io/client-go/testing"
 	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 	fake2 "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+	"k8s.io/utils/ptr"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 )
 
 func TestMetricsServer_Sync(t *testing.T) {
@@ -65,23 +69,58 @@ func TestMetricsServer_Sync(t *testing.T) {
 	}
 }
 
-func TestMetricsServer_Run(t *testing.T) {
-	// test params
+// newTestMetricsServer returns a metrics server whose fake client holds the QWorker and its ScalerConfig, named
+// after the test. The QWorker polls test-queue of the ScalerConfig, whose broker is brokerMock.
+func newTestMetricsServer(t *testing.T, qworker *v1alpha1.QWorker, brokerMock *mocks.Broker, interceptorFuncs ...interceptor.Funcs) (*MetricsServer, ctrlclient.Client) {
 	testID := fmt.Sprintf("test-%d", time.Now().UnixNano())
-	resourceName := fmt.Sprintf("qworker-%s", testID)
-	scalerConfigName := fmt.Sprintf("scalerconfig-%s", testID)
-	namespace := "default"
-	configKey := fmt.Sprintf("%s/%s", namespace, scalerConfigName)
+	scalerConfig := &v1alpha1.ScalerConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("scalerconfig-%s", testID), Namespace: "default"},
+	}
+	configKey := fmt.Sprintf("%s/%s", scalerConfig.Namespace, scalerConfig.Name)
+	scalerConfig.Spec.Type = configKey
+	qworker.Name = fmt.Sprintf("qworker-%s", testID)
+	qworker.Namespace = scalerConfig.Namespace
+	qworker.Spec.ScaleConfig.ScalerConfigRef = scalerConfig.Name
+	qworker.Spec.ScaleConfig.Queue = "test-queue"
 
 	scheme := runtime.NewScheme()
 	_ = v1alpha1.AddToScheme(scheme)
+	builder := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(qworker, scalerConfig).
+		WithStatusSubresource(qworker)
+	for _, funcs := range interceptorFuncs {
+		builder = builder.WithInterceptorFuncs(funcs)
+	}
+	client := builder.Build()
 
-	// create qworker resource
+	brokers.RegisterBrokerType(configKey, func(*v1alpha1.ScalerConfig) (brokers.Broker, error) { return brokerMock, nil }, nil)
+	t.Cleanup(func() {
+		brokers.UnregisterBrokerType(configKey)
+		delete(brokers.BrokerRegistry, configKey)
+	})
+	return &MetricsServer{client: client, Scheme: scheme}, client
+}
+
+// getQWorker reads the QWorker as the metrics server last wrote it
+func getQWorker(t *testing.T, client ctrlclient.Client, qworker *v1alpha1.QWorker) *v1alpha1.QWorker {
+	updatedQWorker := &v1alpha1.QWorker{}
+	if err := client.Get(context.Background(), ctrlclient.ObjectKeyFromObject(qworker), updatedQWorker); err != nil {
+		t.Fatalf("Failed to get QWorker: %v", err)
+	}
+	return updatedQWorker
+}
+
+// runOnce polls the QWorkers of the metrics server once
+func runOnce(t *testing.T, server *MetricsServer) {
+	if err := server.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	server.scheduler.Wait()
+}
+
+func TestMetricsServer_Run(t *testing.T) {
 	qworkerResource := &v1alpha1.QWorker{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      resourceName,
-			Namespace: namespace,
-		},
 		Spec: v1alpha1.QWorkerSpec{
 			PodSpec: corev1.PodSpec{
 				Containers: []corev1.Container{
@@ -92,66 +131,59 @@ func TestMetricsServer_Run(t *testing.T) {
 				},
 			},
 			ScaleConfig: v1alpha1.QWorkerScaleConfig{
-				ScalerConfigRef: scalerConfigName,
-				Queue:           "test-queue",
-				MinReplicas:     1,
-				MaxReplicas:     10,
-				ScalingFactor:   1,
+				MinReplicas:   1,
+				MaxReplicas:   10,
+				ScalingFactor: ptr.To(1),
 			},
 		},
-		Status: v1alpha1.QWorkerStatus{},
 	}
+	brokerMock := &mocks.Broker{}
+	brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(10, nil)
+	server, client := newTestMetricsServer(t, qworkerResource, brokerMock)
 
-	// create scalerconfig resource
-	scalerConfigResource := &v1alpha1.ScalerConfig{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      scalerConfigName,
-			Namespace: namespace,
-		},
-		Spec: v1alpha1.ScalerConfigSpec{
-			Type:   configKey,
-			Config: v1alpha1.ScalerTypeConfigs{},
-		},
-	}
+	runOnce(t, server)
 
-	// create empty qworkerlist
-	qworkerList := &v1alpha1.QWorkerList{
-		Items: []v1alpha1.QWorker{},
+	// Verify updates
+	updatedQWorker := getQWorker(t, client, qworkerResource)
+	if updatedQWorker.Status.DesiredReplicas != 10 {
+		t.Errorf("Expected desired replicas to be 10, got %d", updatedQWorker.Status.DesiredReplicas)
 	}
-
-	// create fake client with the resources
-	client := fake.NewClientBuilder().
-		WithScheme(scheme).
-		WithObjects(qworkerResource, scalerConfigResource).
-		WithStatusSubresource(qworkerResource).
-		Build()
-
-	server := MetricsServer{
-		client:   client,
-		Scheme:   scheme,
-		qworkers: qworkerList,
+	if updatedQWorker.Status.QueueLength != 10 {
+		t.Errorf("Expected queue length to be 10, got %d", updatedQWorker.Status.QueueLength)
+	}
+	for _, conditionType := range []string{v1alpha1.ScalerConfigResolvedCondition, v1alpha1.BrokerReachableCondition, v1alpha1.ScalingActiveCondition} {
+		if !meta.IsStatusConditionTrue(updatedQWorker.Status.Conditions, conditionType) {
+			t.Errorf("Expected condition %s to be true, got %v", conditionType, updatedQWorker.Status.Conditions)
+		}
 	}
+	if !meta.IsStatusConditionFalse(updatedQWorker.Status.Conditions, v1alpha1.ScalingLimitedCondition) {
+		t.Errorf("Expected condition %s to be false, got %v", v1alpha1.ScalingLimitedCondition, updatedQWorker.Status.Conditions)
+	}
+}
 
+func TestMetricsServer_Run_BrokerError(t *testing.T) {
+	qworkerResource := &v1alpha1.QWorker{
+		Spec: v1alpha1.QWorkerSpec{
+			ScaleConfig: v1alpha1.QWorkerScaleConfig{MinReplicas: 1, MaxReplicas: 10, ScalingFactor: ptr.To(1)},
+		},
+		Status: v1alpha1.QWorkerStatus{DesiredReplicas: 3},
+	}
 	brokerMock := &mocks.Broker{}
-	brokers.BrokerRegistry[configKey] = brokerMock
-	brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(10, nil)
+	brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(-1, fmt.Errorf("connection refused"))
+	server, client := newTestMetricsServer(t, qworkerResource, brokerMock)
 
-	// Run the server
-	ctx := context.Background()
-	err := server.Run(ctx)
-	if err != nil {
-		t.Fatalf("Run failed: %v", err)
-	}
+	runOnce(t, server)
 
-	// Verify updates
-	updatedQWorker := &v1alpha1.QWorker{}
-	err = client.Get(ctx, ctrlclient.ObjectKeyFromObject(qworkerResource), updatedQWorker)
-	if err != nil {
-		t.Fatalf("Failed to get updated QWorker: %v", err)
+	updatedQWorker := getQWorker(t, client, qworkerResource)
+	if updatedQWorker.Status.DesiredReplicas != 3 {
+		t.Errorf("Expected desired replicas to stay 3, got %d", updatedQWorker.Status.DesiredReplicas)
 	}
-
-	if updatedQWorker.Status.DesiredReplicas != 10 {
-		t.Errorf("Expected desired replicas to be 10, got %d", updatedQWorker.Status.DesiredReplicas)
+	brokerReachable := meta.FindStatusCondition(updatedQWorker.Status.Conditions, v1alpha1.BrokerReachableCondition)
+	if brokerReachable == nil || brokerReachable.Status != metav1.ConditionFalse || brokerReachable.Reason != "FailedGetQueueLength" {
+		t.Errorf("Expected the broker to be reported unreachable, got %v", brokerReachable)
+	}
+	if !meta.IsStatusConditionFalse(updatedQWorker.Status.Conditions, v1alpha1.ScalingActiveCondition) {
+		t.Errorf("Expected scaling to be reported inactive, got %v", updatedQWorker.Status.Conditions)
 	}
 }
 
@@ -372,3 +404,192 @@ func TestRightSizeContainers(t *testing.T) {
 		})
 	}
 }
+
+func TestMetricsServer_Start(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+
+	server := &MetricsServer{
+		client:   fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Scheme:   scheme,
+		qworkers: &v1alpha1.QWorkerList{},
+	}
+	if !server.NeedLeaderElection() {
+		t.Errorf("expected the metrics server to run on the leader only")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.Start(ctx) }()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("metrics server did not stop with its context")
+	}
+}
+
+func TestMetricsServer_Run_ManualReplicasExpired(t *testing.T) {
+	qworkerResource := &v1alpha1.QWorker{
+		Spec: v1alpha1.QWorkerSpec{
+			Replicas:                 ptr.To(8),
+			ManualReplicasTTLSeconds: ptr.To(60),
+			ScaleConfig:              v1alpha1.QWorkerScaleConfig{MinReplicas: 1, MaxReplicas: 10, ScalingFactor: ptr.To(1)},
+		},
+		Status: v1alpha1.QWorkerStatus{
+			DesiredReplicas:    8,
+			ManualReplicas:     ptr.To(8),
+			ManualReplicasTime: &metav1.Time{Time: time.Now().Add(-2 * time.Minute)},
+		},
+	}
+	brokerMock := &mocks.Broker{}
+	brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(3, nil)
+	server, client := newTestMetricsServer(t, qworkerResource, brokerMock)
+
+	runOnce(t, server)
+
+	updatedQWorker := getQWorker(t, client, qworkerResource)
+	if updatedQWorker.Spec.Replicas != nil {
+		t.Errorf("Expected the expired spec.replicas to be cleared, got %d", *updatedQWorker.Spec.Replicas)
+	}
+	if updatedQWorker.Status.DesiredReplicas != 3 {
+		t.Errorf("Expected desired replicas to follow the queue again, got %d", updatedQWorker.Status.DesiredReplicas)
+	}
+	manualOverride := meta.FindStatusCondition(updatedQWorker.Status.Conditions, v1alpha1.ManualOverrideCondition)
+	if manualOverride == nil || manualOverride.Reason != "Expired" {
+		t.Errorf("Expected the manual override to be reported as expired, got %v", manualOverride)
+	}
+}
+
+func TestMetricsServer_Run_Fallback(t *testing.T) {
+	qworkerResource := &v1alpha1.QWorker{
+		Spec: v1alpha1.QWorkerSpec{
+			ScaleConfig: v1alpha1.QWorkerScaleConfig{
+				MinReplicas:   1,
+				MaxReplicas:   10,
+				ScalingFactor: ptr.To(1),
+				Fallback:      &v1alpha1.QWorkerFallback{FailureThreshold: 2, Replicas: 5},
+			},
+		},
+		Status: v1alpha1.QWorkerStatus{DesiredReplicas: 3},
+	}
+	brokerMock := &mocks.Broker{}
+	brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(-1, fmt.Errorf("connection refused")).Twice()
+	brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(7, nil).Once()
+	server, client := newTestMetricsServer(t, qworkerResource, brokerMock)
+
+	tests := []struct {
+		name             string
+		expectedDesired  int
+		expectedFailures int
+		expectedStatus   metav1.ConditionStatus
+		expectedReason   string
+	}{
+		{name: "Keeps the last desired replicas below the threshold", expectedDesired: 3, expectedFailures: 1,
+			expectedStatus: metav1.ConditionFalse, expectedReason: "LastKnownReplicas"},
+		{name: "Falls back at the threshold", expectedDesired: 5, expectedFailures: 2,
+			expectedStatus: metav1.ConditionTrue, expectedReason: "FallbackReplicas"},
+		{name: "Follows the queue once it is polled again", expectedDesired: 7, expectedFailures: 0,
+			expectedStatus: metav1.ConditionFalse, expectedReason: "QueuePolled"},
+	}
+
+	// the steps poll the same QWorker in order
+	for _, tt := range tests {
+		server.pollQWorker(context.Background(), *getQWorker(t, client, qworkerResource))
+		updatedQWorker := getQWorker(t, client, qworkerResource)
+		if updatedQWorker.Status.DesiredReplicas != tt.expectedDesired {
+			t.Errorf("%s: expected desired replicas %d, got %d", tt.name, tt.expectedDesired, updatedQWorker.Status.DesiredReplicas)
+		}
+		if updatedQWorker.Status.ConsecutiveFailures != tt.expectedFailures {
+			t.Errorf("%s: expected %d consecutive failures, got %d", tt.name, tt.expectedFailures, updatedQWorker.Status.ConsecutiveFailures)
+		}
+		if gauge := testutil.ToFloat64(desiredReplicasGauge.WithLabelValues(qworkerResource.Namespace, qworkerResource.Name)); gauge != float64(tt.expectedDesired) {
+			t.Errorf("%s: expected the desired replicas gauge at %d, got %v", tt.name, tt.expectedDesired, gauge)
+		}
+		fallback := meta.FindStatusCondition(updatedQWorker.Status.Conditions, v1alpha1.FallbackCondition)
+		if fallback == nil || fallback.Status != tt.expectedStatus || fallback.Reason != tt.expectedReason {
+			t.Errorf("%s: expected the Fallback condition %s with %s, got %v", tt.name, tt.expectedStatus, tt.expectedReason, fallback)
+		}
+	}
+	brokerMock.AssertExpectations(t)
+}
+
+func TestMetricsServer_Run_InvalidScaleConfig(t *testing.T) {
+	qworkerResource := &v1alpha1.QWorker{
+		Spec: v1alpha1.QWorkerSpec{
+			ScaleConfig: v1alpha1.QWorkerScaleConfig{
+				MinReplicas: 1,
+				MaxReplicas: 10,
+				ScalingMode: v1alpha1.RateScalingMode,
+				Fallback:    &v1alpha1.QWorkerFallback{FailureThreshold: 1, Replicas: 5},
+			},
+		},
+		Status: v1alpha1.QWorkerStatus{DesiredReplicas: 3},
+	}
+	brokerMock := &mocks.Broker{}
+	brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(7, nil)
+	server, client := newTestMetricsServer(t, qworkerResource, brokerMock)
+
+	// polled twice, past the failure threshold of the fallback
+	for range 2 {
+		server.pollQWorker(context.Background(), *getQWorker(t, client, qworkerResource))
+	}
+
+	qworker := getQWorker(t, client, qworkerResource)
+	if qworker.Status.DesiredReplicas != 3 {
+		t.Errorf("expected the last desired replicas 3 to be kept, got %d", qworker.Status.DesiredReplicas)
+	}
+	if qworker.Status.ConsecutiveFailures != 0 {
+		t.Errorf("expected no consecutive failures, got %d", qworker.Status.ConsecutiveFailures)
+	}
+	scalingActive := meta.FindStatusCondition(qworker.Status.Conditions, v1alpha1.ScalingActiveCondition)
+	if scalingActive == nil || scalingActive.Status != metav1.ConditionFalse || scalingActive.Reason != "InvalidScaleConfig" {
+		t.Errorf("expected the ScalingActive condition False with InvalidScaleConfig, got %v", scalingActive)
+	}
+	fallback := meta.FindStatusCondition(qworker.Status.Conditions, v1alpha1.FallbackCondition)
+	if fallback == nil || fallback.Status != metav1.ConditionFalse {
+		t.Errorf("expected the Fallback condition to be False, got %v", fallback)
+	}
+}
+
+func TestMetricsServer_Run_ManualReplicasSetAgain(t *testing.T) {
+	qworkerResource := &v1alpha1.QWorker{
+		Spec: v1alpha1.QWorkerSpec{
+			Replicas:                 ptr.To(8),
+			ManualReplicasTTLSeconds: ptr.To(60),
+			ScaleConfig:              v1alpha1.QWorkerScaleConfig{MinReplicas: 1, MaxReplicas: 10},
+		},
+		Status: v1alpha1.QWorkerStatus{
+			DesiredReplicas:    8,
+			ManualReplicas:     ptr.To(8),
+			ManualReplicasTime: &metav1.Time{Time: time.Now().Add(-2 * time.Minute)},
+		},
+	}
+	brokerMock := &mocks.Broker{}
+	brokerMock.On("GetQueueLength", mock.Anything, mock.Anything).Return(3, nil)
+	// the QWorker is scaled by hand again right after its status is written
+	server, client := newTestMetricsServer(t, qworkerResource, brokerMock, interceptor.Funcs{
+		SubResourceUpdate: func(ctx context.Context, c ctrlclient.Client, subResource string, obj ctrlclient.Object, opts ...ctrlclient.SubResourceUpdateOption) error {
+			if err := c.SubResource(subResource).Update(ctx, obj, opts...); err != nil {
+				return err
+			}
+			scaled := &v1alpha1.QWorker{}
+			if err := c.Get(ctx, ctrlclient.ObjectKeyFromObject(obj), scaled); err != nil {
+				return err
+			}
+			scaled.Spec.Replicas = ptr.To(12)
+			return c.Update(ctx, scaled)
+		},
+	})
+
+	runOnce(t, server)
+
+	updatedQWorker := getQWorker(t, client, qworkerResource)
+	if updatedQWorker.Spec.Replicas == nil || *updatedQWorker.Spec.Replicas != 12 {
+		t.Errorf("Expected the new spec.replicas 12 to be kept, got %v", updatedQWorker.Spec.Replicas)
+	}
+}
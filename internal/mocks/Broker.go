@@ -13,6 +13,24 @@ type Broker struct {
 	mock.Mock
 }
 
+// Close provides a mock function with given fields:
+func (_m *Broker) Close() error {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Close")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetQueueLength provides a mock function with given fields: ctx, topic
 func (_m *Broker) GetQueueLength(ctx *context.Context, topic string) (int, error) {
 	ret := _m.Called(ctx, topic)
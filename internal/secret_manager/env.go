@@ -0,0 +1,41 @@
+package secret_manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+)
+
+// envBackend reads secrets from environment variables of the operator
+type envBackend struct {
+	prefix string
+}
+
+// NewEnvBackend returns a backend reading the environment variables whose name starts with prefix and the
+// namespace of the ScalerConfig, so ScalerConfigs can not read the variables of other namespaces nor the rest
+// of the environment of the operator
+func NewEnvBackend(prefix string) SecretBackend {
+	return &envBackend{prefix: prefix}
+}
+
+// Get reads a variable named after the prefix, the namespace upper cased with its dashes replaced by
+// underscores and a double underscore, e.g. QSCALER_SECRET_TEAM_A__REDIS_PASSWORD in the team-a namespace
+func (e *envBackend) Get(_ context.Context, namespace string, secret v1alpha1.ValueOrSecret) (string, error) {
+	namespacePrefix := e.prefix + strings.ToUpper(strings.ReplaceAll(namespace, "-", "_")) + "__"
+	// a double underscore in the name would let the variable match the prefix of another namespace too,
+	// e.g. TEAM__A__REDIS would be read by both the team and the team--a namespaces
+	name, found := strings.CutPrefix(secret.Env, namespacePrefix)
+	if namespace == "" || !found || name == "" || strings.Contains(name, "__") {
+		return "", fmt.Errorf("environment variable %s does not start with the secret prefix %s of namespace %s, "+
+			"followed by a name without double underscores", secret.Env, namespacePrefix, namespace)
+	}
+
+	value, ok := os.LookupEnv(secret.Env)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", secret.Env)
+	}
+	return value, nil
+}
@@ -0,0 +1,35 @@
+package secret_manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+)
+
+// fileBackend reads secrets from files under a directory of the operator, e.g. a Secrets Store CSI volume
+type fileBackend struct {
+	dir string
+}
+
+// NewFileBackend returns a backend reading files relative to the directory of each namespace under dir, e.g.
+// dir/team-a for the ScalerConfigs of team-a. Paths leaving that directory are rejected, so ScalerConfigs can
+// not read the files of other namespaces nor other files of the operator.
+func NewFileBackend(dir string) SecretBackend {
+	return &fileBackend{dir: dir}
+}
+
+func (f *fileBackend) Get(_ context.Context, namespace string, secret v1alpha1.ValueOrSecret) (string, error) {
+	if !filepath.IsLocal(secret.File) || !filepath.IsLocal(namespace) {
+		return "", fmt.Errorf("secret file %s is not a relative path inside the secret files directory of namespace %s",
+			secret.File, namespace)
+	}
+
+	bytes, err := os.ReadFile(filepath.Join(f.dir, namespace, secret.File))
+	if err != nil {
+		return "", fmt.Errorf("unable to read secret file %s: %w", secret.File, err)
+	}
+	return string(bytes), nil
+}
@@ -3,76 +3,105 @@ package secret_manager
 import (
 	"context"
 	"fmt"
-	"os"
+	"maps"
 	"sync"
 
 	"github.com/quickube/QScaler/api/v1alpha1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var (
-	// Singleton instance and sync.Once
-	secretManagerInstance SecretManager
-	once                  sync.Once
+	// backends are shared by the secret managers of every namespace, keyed by name
+	backends      = make(map[string]SecretBackend)
+	backendsMutex sync.RWMutex
 )
 
 type SecretManagerInst struct {
-	client    kubernetes.Interface
+	backends  map[string]SecretBackend
 	namespace string
 }
 
-func NewClient() (SecretManager, error) {
-	var initErr error
+// RegisterBackend makes a secret backend available to secret managers, replacing the backend of the same
+// name. A nil backend removes it.
+func RegisterBackend(name string, backend SecretBackend) {
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
 
-	once.Do(func() {
-		// Initialize configuration
-		config, err := rest.InClusterConfig()
-		if err != nil {
-			initErr = fmt.Errorf("error getting client config: %v", err)
-			return
-		}
-
-		// Create Kubernetes clientset
-		clientset := kubernetes.NewForConfigOrDie(config)
-
-		// Read namespace from the service account
-		namespacePath := "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
-		namespace, err := os.ReadFile(namespacePath)
-		if err != nil {
-			initErr = fmt.Errorf("could not read namespace file %s: %w", namespacePath, err)
-			return
-		}
+	if backend == nil {
+		delete(backends, name)
+		return
+	}
+	backends[name] = backend
+}
 
-		// Create the singleton instance
-		secretManager := &SecretManagerInst{
-			client:    clientset,
-			namespace: string(namespace),
-		}
+// SetClient sets the client Kubernetes secrets are read with, usually the cached client of the manager
+func SetClient(c client.Reader) {
+	if c == nil {
+		RegisterBackend(KubernetesBackend, nil)
+		return
+	}
+	RegisterBackend(KubernetesBackend, &kubernetesBackend{client: c})
+}
 
-		secretManagerInstance = secretManager
-	})
+// NewClient returns a secret manager that reads the secrets of the given namespace, which is the
+// namespace of the object referencing them
+func NewClient(namespace string) (SecretManager, error) {
+	backendsMutex.RLock()
+	defer backendsMutex.RUnlock()
 
-	return secretManagerInstance, initErr
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("no secret backend is set up")
+	}
+	return &SecretManagerInst{
+		backends:  maps.Clone(backends),
+		namespace: namespace,
+	}, nil
 }
 
 func (s *SecretManagerInst) Get(secret v1alpha1.ValueOrSecret) (string, error) {
+	name := backendOf(secret)
+	if name == "" {
+		return secret.Value, nil
+	}
 
-	if secret.Secret != nil {
-		var ok bool
-		var bytes []byte
-		k8sSecret, err := s.client.CoreV1().Secrets(s.namespace).Get(context.Background(), secret.Secret.Name, metav1.GetOptions{})
-		if err != nil {
-			return "", err
-		}
+	backend, ok := s.backends[name]
+	if !ok {
+		return "", fmt.Errorf("the %s secret backend is not set up", name)
+	}
+	return backend.Get(context.Background(), s.namespace, secret)
+}
 
-		if bytes, ok = k8sSecret.Data[secret.Secret.Key]; !ok {
-			return "", fmt.Errorf("missing key %s in secret %s", secret.Secret.Key, s.namespace)
-		}
+// backendOf returns the name of the backend the secret is read from, or an empty name for plaintext values
+func backendOf(secret v1alpha1.ValueOrSecret) string {
+	switch {
+	case secret.Secret != nil:
+		return KubernetesBackend
+	case secret.File != "":
+		return FileBackend
+	case secret.Env != "":
+		return EnvBackend
+	case secret.Vault != nil:
+		return VaultBackend
+	}
+	return ""
+}
 
-		return string(bytes), nil
+// kubernetesBackend reads keys of Kubernetes secrets
+type kubernetesBackend struct {
+	client client.Reader
+}
+
+func (k *kubernetesBackend) Get(ctx context.Context, namespace string, secret v1alpha1.ValueOrSecret) (string, error) {
+	k8sSecret := &corev1.Secret{}
+	key := client.ObjectKey{Namespace: namespace, Name: secret.Secret.Name}
+	if err := k.client.Get(ctx, key, k8sSecret); err != nil {
+		return "", err
 	}
 
-	return secret.Value, nil
+	bytes, ok := k8sSecret.Data[secret.Secret.Key]
+	if !ok {
+		return "", fmt.Errorf("missing key %s in secret %s", secret.Secret.Key, key)
+	}
+	return string(bytes), nil
 }
@@ -0,0 +1,130 @@
+package secret_manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSecretManager_Get(t *testing.T) {
+	SetClient(nil)
+	if _, err := NewClient("default"); err == nil {
+		t.Fatal("expected an error before the client is set")
+	}
+
+	SetClient(fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "team-a"},
+		Data:       map[string][]byte{"password": []byte("secret")},
+	}).Build())
+	t.Cleanup(func() { SetClient(nil) })
+
+	secretRef := func(key string) v1alpha1.ValueOrSecret {
+		return v1alpha1.ValueOrSecret{Secret: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "redis"},
+			Key:                  key,
+		}}
+	}
+
+	tests := []struct {
+		name          string
+		namespace     string
+		secret        v1alpha1.ValueOrSecret
+		expected      string
+		expectedError bool
+	}{
+		{name: "Plain value", namespace: "team-a", secret: v1alpha1.ValueOrSecret{Value: "plain"}, expected: "plain"},
+		{name: "Secret of the namespace", namespace: "team-a", secret: secretRef("password"), expected: "secret"},
+		{name: "Missing key", namespace: "team-a", secret: secretRef("username"), expectedError: true},
+		{name: "Secret of another namespace", namespace: "team-b", secret: secretRef("password"), expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secretManager, err := NewClient(tt.namespace)
+			if err != nil {
+				t.Fatalf("NewClient failed: %v", err)
+			}
+			value, err := secretManager.Get(tt.secret)
+			if (err != nil) != tt.expectedError {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if value != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, value)
+			}
+		})
+	}
+}
+
+func TestSecretManager_Backends(t *testing.T) {
+	dir := t.TempDir()
+	for _, namespace := range []string{"default", "team-b"} {
+		if err := os.MkdirAll(filepath.Join(dir, namespace), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		password := []byte(namespace + "-file-secret")
+		if err := os.WriteFile(filepath.Join(dir, namespace, "redis-password"), password, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("QSCALER_SECRET_DEFAULT__REDIS", "env-secret")
+	t.Setenv("QSCALER_SECRET_TEAM_B__REDIS", "team-b-env-secret")
+	t.Setenv("QSCALER_SECRET_DEFAULT__TEAM_B__REDIS", "ambiguous")
+	t.Setenv("QSCALER_SECRET_REDIS", "shared")
+	t.Setenv("OTHER_SECRET", "other")
+
+	RegisterBackend(FileBackend, NewFileBackend(dir))
+	RegisterBackend(EnvBackend, NewEnvBackend("QSCALER_SECRET_"))
+	t.Cleanup(func() {
+		RegisterBackend(FileBackend, nil)
+		RegisterBackend(EnvBackend, nil)
+	})
+
+	secretManager, err := NewClient("default")
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		secret        v1alpha1.ValueOrSecret
+		expected      string
+		expectedError bool
+	}{
+		{name: "File", secret: v1alpha1.ValueOrSecret{File: "redis-password"}, expected: "default-file-secret"},
+		{name: "Missing file", secret: v1alpha1.ValueOrSecret{File: "missing"}, expectedError: true},
+		{name: "File of another namespace", secret: v1alpha1.ValueOrSecret{File: "../team-b/redis-password"}, expectedError: true},
+		{name: "Absolute file", secret: v1alpha1.ValueOrSecret{File: filepath.Join(dir, "default", "redis-password")}, expectedError: true},
+		{name: "Environment variable", secret: v1alpha1.ValueOrSecret{Env: "QSCALER_SECRET_DEFAULT__REDIS"}, expected: "env-secret"},
+		{name: "Unset environment variable", secret: v1alpha1.ValueOrSecret{Env: "QSCALER_SECRET_DEFAULT__MISSING"}, expectedError: true},
+		{name: "Environment variable of another namespace", secret: v1alpha1.ValueOrSecret{Env: "QSCALER_SECRET_TEAM_B__REDIS"}, expectedError: true},
+		{name: "Environment variable without a namespace", secret: v1alpha1.ValueOrSecret{Env: "QSCALER_SECRET_REDIS"}, expectedError: true},
+		{
+			name:          "Environment variable with a double underscore in its name",
+			secret:        v1alpha1.ValueOrSecret{Env: "QSCALER_SECRET_DEFAULT__TEAM_B__REDIS"},
+			expectedError: true,
+		},
+		{name: "Environment variable without the prefix", secret: v1alpha1.ValueOrSecret{Env: "OTHER_SECRET"}, expectedError: true},
+		{
+			name:          "Backend that is not set up",
+			secret:        v1alpha1.ValueOrSecret{Vault: &v1alpha1.VaultSecretSelector{Path: "redis", Key: "password"}},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := secretManager.Get(tt.secret)
+			if (err != nil) != tt.expectedError {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if value != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, value)
+			}
+		})
+	}
+}
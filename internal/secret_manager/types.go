@@ -1,9 +1,24 @@
 package secret_manager
 
 import (
+	"context"
+
 	"github.com/quickube/QScaler/api/v1alpha1"
 )
 
+// The names of the secret backends, after the field of ValueOrSecret that selects them
+const (
+	KubernetesBackend = "secret"
+	FileBackend       = "file"
+	EnvBackend        = "env"
+	VaultBackend      = "vault"
+)
+
 type SecretManager interface {
 	Get(secret v1alpha1.ValueOrSecret) (string, error)
 }
+
+// SecretBackend resolves the secret references of one kind for objects of the given namespace
+type SecretBackend interface {
+	Get(ctx context.Context, namespace string, secret v1alpha1.ValueOrSecret) (string, error)
+}
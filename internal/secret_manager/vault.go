@@ -0,0 +1,210 @@
+package secret_manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+)
+
+const (
+	defaultVaultAuthMount = "kubernetes"
+	defaultVaultKVMount   = "secret"
+	// DefaultServiceAccountTokenPath is the token the operator logs in to Vault with
+	DefaultServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// errVaultForbidden is returned for requests Vault denies, which happens once the token expired
+var errVaultForbidden = errors.New("permission denied")
+
+type VaultOptions struct {
+	// Address of the Vault server, e.g. https://vault.vault.svc:8200
+	Address string
+	// Role of the Kubernetes auth method the operator logs in as
+	Role string
+	// AuthMount is the path the Kubernetes auth method is mounted at, kubernetes by default
+	AuthMount string
+	// TokenPath is the service account token sent to Vault, the token of the operator pod by default
+	TokenPath string
+	// HTTPClient defaults to a client with a 10 seconds timeout
+	HTTPClient *http.Client
+}
+
+// vaultBackend reads KV v2 secrets from HashiCorp Vault, logging in with the Kubernetes auth method
+type vaultBackend struct {
+	options VaultOptions
+
+	tokenMutex  sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewVaultBackend returns a backend reading Vault secrets with the policies of the role of the operator
+func NewVaultBackend(options VaultOptions) SecretBackend {
+	if options.AuthMount == "" {
+		options.AuthMount = defaultVaultAuthMount
+	}
+	if options.TokenPath == "" {
+		options.TokenPath = DefaultServiceAccountTokenPath
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	options.Address = strings.TrimSuffix(options.Address, "/")
+	return &vaultBackend{options: options}
+}
+
+// Get reads a secret below the path of the namespace of the ScalerConfig, e.g. secret/team-a/redis for the path
+// redis of a ScalerConfig of team-a, so ScalerConfigs can not read the secrets of other namespaces
+func (v *vaultBackend) Get(ctx context.Context, namespace string, secret v1alpha1.ValueOrSecret) (string, error) {
+	selector := secret.Vault
+	mount := selector.Mount
+	if mount == "" {
+		mount = defaultVaultKVMount
+	}
+	// the path must not leave the namespace, nor the secrets engine for other Vault endpoints
+	if namespace == "" || slices.Contains(strings.Split(mount+"/"+namespace+"/"+selector.Path, "/"), "..") {
+		return "", fmt.Errorf("invalid vault secret path %s/%s of namespace %s", mount, selector.Path, namespace)
+	}
+	path := fmt.Sprintf("/v1/%s/data/%s/%s", strings.Trim(mount, "/"), namespace, strings.TrimPrefix(selector.Path, "/"))
+
+	data, err := v.readSecret(ctx, path)
+	if errors.Is(err, errVaultForbidden) {
+		// the token may have been revoked before its lease ended, so log in again once
+		v.resetToken()
+		data, err = v.readSecret(ctx, path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to read vault secret %s: %w", selector.Path, err)
+	}
+
+	value, ok := data[selector.Key]
+	if !ok {
+		return "", fmt.Errorf("missing key %s in vault secret %s", selector.Key, selector.Path)
+	}
+	stringValue, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("key %s of vault secret %s is not a string", selector.Key, selector.Path)
+	}
+	return stringValue, nil
+}
+
+// readSecret returns the data of the latest version of a KV v2 secret
+func (v *vaultBackend) readSecret(ctx context.Context, path string) (map[string]interface{}, error) {
+	token, err := v.getToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err = v.do(ctx, http.MethodGet, path, token, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Data.Data, nil
+}
+
+// getToken returns the current Vault token, logging in when there is none or it expired
+func (v *vaultBackend) getToken(ctx context.Context) (string, error) {
+	v.tokenMutex.Lock()
+	defer v.tokenMutex.Unlock()
+
+	if v.token != "" && time.Now().Before(v.tokenExpiry) {
+		return v.token, nil
+	}
+
+	// the token is read on every login, since projected service account tokens are rotated
+	jwt, err := os.ReadFile(v.options.TokenPath)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the service account token: %w", err)
+	}
+
+	var response struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	body := map[string]string{"role": v.options.Role, "jwt": strings.TrimSpace(string(jwt))}
+	path := fmt.Sprintf("/v1/auth/%s/login", strings.Trim(v.options.AuthMount, "/"))
+	if err = v.do(ctx, http.MethodPost, path, "", body, &response); err != nil {
+		return "", fmt.Errorf("unable to log in to vault: %w", err)
+	}
+	if response.Auth.ClientToken == "" {
+		return "", fmt.Errorf("unable to log in to vault: no client token in the response")
+	}
+
+	// renew before the lease ends, so requests in flight do not use an expired token. Tokens without a
+	// lease are kept until Vault denies them.
+	lease := time.Duration(response.Auth.LeaseDuration) * time.Second
+	if lease <= 0 {
+		lease = 100 * 365 * 24 * time.Hour
+	}
+	v.token = response.Auth.ClientToken
+	v.tokenExpiry = time.Now().Add(lease * 9 / 10)
+	return v.token, nil
+}
+
+func (v *vaultBackend) resetToken() {
+	v.tokenMutex.Lock()
+	defer v.tokenMutex.Unlock()
+	v.token = ""
+}
+
+func (v *vaultBackend) do(ctx context.Context, method, path, token string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	endpoint, err := url.JoinPath(v.options.Address, path)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.options.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusForbidden {
+		return errVaultForbidden
+	}
+	if resp.StatusCode != http.StatusOK {
+		var vaultError struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&vaultError)
+		return fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(vaultError.Errors, ", "))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,128 @@
+package secret_manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+)
+
+// newVaultTestServer serves the Kubernetes auth login and a KV v2 secret at secret/team-a/redis
+func newVaultTestServer(t *testing.T, logins *atomic.Int32, validToken *atomic.Value) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/kubernetes/login":
+			var body map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["role"] != "qscaler" || body["jwt"] != "service-account-token" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["invalid role or jwt"]}`))
+				return
+			}
+			token := fmt.Sprintf("token-%d", logins.Add(1))
+			validToken.Store(token)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": token, "lease_duration": 3600},
+			})
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/secret/data/team-a/redis":
+			if r.Header.Get("X-Vault-Token") != validToken.Load() {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     map[string]interface{}{"password": "vault-password", "port": 6379},
+					"metadata": map[string]interface{}{"version": 1},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVaultBackend_Get(t *testing.T) {
+	var logins atomic.Int32
+	var validToken atomic.Value
+	server := newVaultTestServer(t, &logins, &validToken)
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("service-account-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	backend := NewVaultBackend(VaultOptions{Address: server.URL, Role: "qscaler", TokenPath: tokenPath})
+
+	vaultSecret := func(path, key string) v1alpha1.ValueOrSecret {
+		return v1alpha1.ValueOrSecret{Vault: &v1alpha1.VaultSecretSelector{Path: path, Key: key}}
+	}
+
+	tests := []struct {
+		name          string
+		namespace     string
+		secret        v1alpha1.ValueOrSecret
+		expected      string
+		expectedError bool
+	}{
+		{name: "Secret key", namespace: "team-a", secret: vaultSecret("redis", "password"), expected: "vault-password"},
+		{name: "Missing key", namespace: "team-a", secret: vaultSecret("redis", "username"), expectedError: true},
+		{name: "Key that is not a string", namespace: "team-a", secret: vaultSecret("redis", "port"), expectedError: true},
+		{name: "Missing secret", namespace: "team-a", secret: vaultSecret("kafka", "password"), expectedError: true},
+		{name: "Secret of another namespace", namespace: "team-b", secret: vaultSecret("redis", "password"), expectedError: true},
+		{name: "Path leaving the namespace", namespace: "team-b", secret: vaultSecret("../team-a/redis", "password"), expectedError: true},
+		{name: "Path leaving the secrets engine", namespace: "team-a", secret: vaultSecret("../../../sys/health", "password"), expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := backend.Get(context.Background(), tt.namespace, tt.secret)
+			if (err != nil) != tt.expectedError {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if value != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, value)
+			}
+		})
+	}
+
+	if logins.Load() != 1 {
+		t.Errorf("expected the token to be reused, got %d logins", logins.Load())
+	}
+
+	// a revoked token is replaced by logging in again
+	validToken.Store("revoked")
+	value, err := backend.Get(context.Background(), "team-a", vaultSecret("redis", "password"))
+	if err != nil {
+		t.Fatalf("Get failed after the token was revoked: %v", err)
+	}
+	if value != "vault-password" || logins.Load() != 2 {
+		t.Errorf("expected a second login, got %q after %d logins", value, logins.Load())
+	}
+}
+
+func TestVaultBackend_LoginFailure(t *testing.T) {
+	var logins atomic.Int32
+	var validToken atomic.Value
+	server := newVaultTestServer(t, &logins, &validToken)
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("service-account-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	backend := NewVaultBackend(VaultOptions{Address: server.URL, Role: "other", TokenPath: tokenPath})
+
+	_, err := backend.Get(context.Background(), "default",
+		v1alpha1.ValueOrSecret{Vault: &v1alpha1.VaultSecretSelector{Path: "team-a/redis", Key: "password"}})
+	if err == nil {
+		t.Fatal("expected an error when the role is rejected")
+	}
+}
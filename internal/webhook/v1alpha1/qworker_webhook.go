@@ -0,0 +1,185 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// defaultMaxReplicas is the maxReplicas of QWorkers that do not set one
+const defaultMaxReplicas = 10
+
+// SetupQWorkerWebhookWithManager registers the defaulting and validating webhooks of QWorker in the manager
+func SetupQWorkerWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&v1alpha1.QWorker{}).
+		WithDefaulter(&QWorkerCustomDefaulter{}).
+		WithValidator(&QWorkerCustomValidator{client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-quickube-com-v1alpha1-qworker,mutating=true,failurePolicy=fail,sideEffects=None,groups=quickube.com,resources=qworkers,verbs=create;update,versions=v1alpha1,name=mqworker-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// QWorkerCustomDefaulter sets the defaults of QWorkers that the CRD schema can not express
+type QWorkerCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &QWorkerCustomDefaulter{}
+
+// Default sets a scalingFactor of 1 when no scaling target is set, and a maxReplicas of at least
+// defaultMaxReplicas when none is set
+func (d *QWorkerCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	qworker, ok := obj.(*v1alpha1.QWorker)
+	if !ok {
+		return fmt.Errorf("expected a QWorker object but got %T", obj)
+	}
+
+	scaleConfig := &qworker.Spec.ScaleConfig
+	if scaleConfig.ScalingFactor == nil && scaleConfig.TargetQueueLengthPerReplica == nil {
+		scaleConfig.ScalingFactor = ptr.To(1)
+	}
+	if scaleConfig.MaxReplicas == 0 {
+		scaleConfig.MaxReplicas = max(scaleConfig.MinReplicas, defaultMaxReplicas)
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-quickube-com-v1alpha1-qworker,mutating=false,failurePolicy=fail,sideEffects=None,groups=quickube.com,resources=qworkers,verbs=create;update,versions=v1alpha1,name=vqworker-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// QWorkerCustomValidator rejects QWorkers that can not be scaled, and warns about missing ScalerConfigs
+type QWorkerCustomValidator struct {
+	client client.Reader
+}
+
+var _ webhook.CustomValidator = &QWorkerCustomValidator{}
+
+func (v *QWorkerCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	qworker, ok := obj.(*v1alpha1.QWorker)
+	if !ok {
+		return nil, fmt.Errorf("expected a QWorker object but got %T", obj)
+	}
+	return v.validate(ctx, qworker)
+}
+
+// ValidateUpdate only validates changes of the scale config, so QWorkers created before the webhook was enabled
+// can still have their manual replicas cleared, get and lose their finalizers, and be deleted
+func (v *QWorkerCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	qworker, ok := newObj.(*v1alpha1.QWorker)
+	if !ok {
+		return nil, fmt.Errorf("expected a QWorker object but got %T", newObj)
+	}
+	oldQWorker, ok := oldObj.(*v1alpha1.QWorker)
+	if !ok {
+		return nil, fmt.Errorf("expected a QWorker object but got %T", oldObj)
+	}
+	if qworker.DeletionTimestamp != nil || equality.Semantic.DeepEqual(oldQWorker.Spec.ScaleConfig, qworker.Spec.ScaleConfig) {
+		return nil, nil
+	}
+	return v.validate(ctx, qworker)
+}
+
+func (v *QWorkerCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *QWorkerCustomValidator) validate(ctx context.Context, qworker *v1alpha1.QWorker) (admission.Warnings, error) {
+	warnings := v.scalerConfigWarnings(ctx, qworker)
+	allErrs := validateScaleConfig(qworker.Spec.ScaleConfig, field.NewPath("spec", "scaleConfig"))
+	if len(allErrs) == 0 {
+		return warnings, nil
+	}
+	return warnings, apierrors.NewInvalid(v1alpha1.GroupVersion.WithKind("QWorker").GroupKind(), qworker.Name, allErrs)
+}
+
+// scalerConfigWarnings warns when the referenced ScalerConfig does not exist, since it may be created later
+func (v *QWorkerCustomValidator) scalerConfigWarnings(ctx context.Context, qworker *v1alpha1.QWorker) admission.Warnings {
+	scalerConfigRef := qworker.Spec.ScaleConfig.ScalerConfigRef
+	if scalerConfigRef == "" || v.client == nil {
+		return nil
+	}
+
+	var scalerConfig v1alpha1.ScalerConfig
+	err := v.client.Get(ctx, client.ObjectKey{Namespace: qworker.Namespace, Name: scalerConfigRef}, &scalerConfig)
+	if apierrors.IsNotFound(err) {
+		return admission.Warnings{fmt.Sprintf("ScalerConfig %s not found in namespace %s, the QWorker is not scaled until it is created",
+			scalerConfigRef, qworker.Namespace)}
+	}
+	if err != nil {
+		log.Log.Error(err, "unable to check the ScalerConfig of QWorker", "name", qworker.Name)
+	}
+	return nil
+}
+
+func validateScaleConfig(scaleConfig v1alpha1.QWorkerScaleConfig, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if scaleConfig.ScalerConfigRef == "" {
+		allErrs = append(allErrs, field.Required(path.Child("scalerConfigRef"), "the ScalerConfig of the queue must be set"))
+	}
+	if scaleConfig.Queue == "" {
+		allErrs = append(allErrs, field.Required(path.Child("queue"), "the queue to scale on must be set"))
+	}
+
+	if scaleConfig.MinReplicas < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("minReplicas"), scaleConfig.MinReplicas, "must not be negative"))
+	}
+	if scaleConfig.MaxReplicas < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("maxReplicas"), scaleConfig.MaxReplicas, "must not be negative"))
+	}
+	if scaleConfig.MinReplicas > scaleConfig.MaxReplicas {
+		allErrs = append(allErrs, field.Invalid(path.Child("minReplicas"), scaleConfig.MinReplicas,
+			fmt.Sprintf("must not be greater than maxReplicas %d", scaleConfig.MaxReplicas)))
+	}
+	if scaleConfig.ScalingFactor != nil && *scaleConfig.ScalingFactor < 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("scalingFactor"), *scaleConfig.ScalingFactor, "must not be negative"))
+	}
+	if target := scaleConfig.TargetQueueLengthPerReplica; target != nil && target.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(path.Child("targetQueueLengthPerReplica"), target.String(), "must be positive"))
+	}
+
+	if fallback := scaleConfig.Fallback; fallback != nil {
+		if fallback.FailureThreshold < 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("fallback", "failureThreshold"), fallback.FailureThreshold, "must not be negative"))
+		}
+		if fallback.Replicas < scaleConfig.MinReplicas || fallback.Replicas > scaleConfig.MaxReplicas {
+			allErrs = append(allErrs, field.Invalid(path.Child("fallback", "replicas"), fallback.Replicas,
+				fmt.Sprintf("must be between minReplicas %d and maxReplicas %d", scaleConfig.MinReplicas, scaleConfig.MaxReplicas)))
+		}
+	}
+
+	if scaleConfig.ScalingMode == v1alpha1.RateScalingMode {
+		throughput := scaleConfig.ThroughputPerReplica
+		if throughput == nil {
+			allErrs = append(allErrs, field.Required(path.Child("throughputPerReplica"),
+				fmt.Sprintf("is required by the %s scaling mode", v1alpha1.RateScalingMode)))
+		} else if throughput.Sign() <= 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("throughputPerReplica"), throughput.String(), "must be positive"))
+		}
+	}
+	return allErrs
+}
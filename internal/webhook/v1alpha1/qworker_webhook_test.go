@@ -0,0 +1,191 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestQWorkerCustomDefaulter(t *testing.T) {
+	target := resource.MustParse("50")
+
+	tests := []struct {
+		name                  string
+		scaleConfig           v1alpha1.QWorkerScaleConfig
+		expectedScalingFactor *int
+		expectedMaxReplicas   int
+	}{
+		{
+			name:                  "Defaults the scaling factor and max replicas",
+			scaleConfig:           v1alpha1.QWorkerScaleConfig{},
+			expectedScalingFactor: ptr.To(1),
+			expectedMaxReplicas:   defaultMaxReplicas,
+		},
+		{
+			name:                  "Keeps the max replicas above the min replicas",
+			scaleConfig:           v1alpha1.QWorkerScaleConfig{MinReplicas: 15},
+			expectedScalingFactor: ptr.To(1),
+			expectedMaxReplicas:   15,
+		},
+		{
+			name:                  "Keeps the values that are set",
+			scaleConfig:           v1alpha1.QWorkerScaleConfig{ScalingFactor: ptr.To(3), MaxReplicas: 4},
+			expectedScalingFactor: ptr.To(3),
+			expectedMaxReplicas:   4,
+		},
+		{
+			name:                  "No scaling factor with a target queue length",
+			scaleConfig:           v1alpha1.QWorkerScaleConfig{TargetQueueLengthPerReplica: &target, MaxReplicas: 4},
+			expectedScalingFactor: nil,
+			expectedMaxReplicas:   4,
+		},
+		{
+			name:                  "Keeps a scaling factor of 0",
+			scaleConfig:           v1alpha1.QWorkerScaleConfig{ScalingFactor: ptr.To(0), MaxReplicas: 4},
+			expectedScalingFactor: ptr.To(0),
+			expectedMaxReplicas:   4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qworker := &v1alpha1.QWorker{Spec: v1alpha1.QWorkerSpec{ScaleConfig: tt.scaleConfig}}
+			if err := (&QWorkerCustomDefaulter{}).Default(context.Background(), qworker); err != nil {
+				t.Fatalf("Default failed: %v", err)
+			}
+			if !ptr.Equal(qworker.Spec.ScaleConfig.ScalingFactor, tt.expectedScalingFactor) {
+				t.Errorf("expected scaling factor %v, got %v", ptr.Deref(tt.expectedScalingFactor, -1), ptr.Deref(qworker.Spec.ScaleConfig.ScalingFactor, -1))
+			}
+			if qworker.Spec.ScaleConfig.MaxReplicas != tt.expectedMaxReplicas {
+				t.Errorf("expected max replicas %d, got %d", tt.expectedMaxReplicas, qworker.Spec.ScaleConfig.MaxReplicas)
+			}
+		})
+	}
+}
+
+func TestQWorkerCustomValidator(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1alpha1.AddToScheme(scheme)
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(&v1alpha1.ScalerConfig{ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "default"}}).
+		Build()
+	validator := &QWorkerCustomValidator{client: client}
+
+	validScaleConfig := func() v1alpha1.QWorkerScaleConfig {
+		return v1alpha1.QWorkerScaleConfig{
+			ScalerConfigRef: "redis",
+			Queue:           "tasks",
+			MinReplicas:     1,
+			MaxReplicas:     5,
+			ScalingFactor:   ptr.To(1),
+		}
+	}
+	zero := resource.MustParse("0")
+
+	tests := []struct {
+		name             string
+		mutate           func(*v1alpha1.QWorkerScaleConfig)
+		expectedError    bool
+		expectedWarnings int
+	}{
+		{name: "Valid", mutate: func(*v1alpha1.QWorkerScaleConfig) {}},
+		{name: "Min replicas above max replicas", mutate: func(c *v1alpha1.QWorkerScaleConfig) { c.MinReplicas = 6 }, expectedError: true},
+		{name: "Negative min replicas", mutate: func(c *v1alpha1.QWorkerScaleConfig) { c.MinReplicas = -1 }, expectedError: true},
+		{name: "Negative scaling factor", mutate: func(c *v1alpha1.QWorkerScaleConfig) { c.ScalingFactor = ptr.To(-2) }, expectedError: true},
+		{name: "Empty queue", mutate: func(c *v1alpha1.QWorkerScaleConfig) { c.Queue = "" }, expectedError: true},
+		{name: "Zero target queue length", mutate: func(c *v1alpha1.QWorkerScaleConfig) { c.TargetQueueLengthPerReplica = &zero }, expectedError: true},
+		{name: "Rate mode without throughput", mutate: func(c *v1alpha1.QWorkerScaleConfig) { c.ScalingMode = v1alpha1.RateScalingMode }, expectedError: true},
+		{name: "Fallback replicas above max replicas", mutate: func(c *v1alpha1.QWorkerScaleConfig) {
+			c.Fallback = &v1alpha1.QWorkerFallback{FailureThreshold: 3, Replicas: 6}
+		}, expectedError: true},
+		{name: "Fallback within range", mutate: func(c *v1alpha1.QWorkerScaleConfig) {
+			c.Fallback = &v1alpha1.QWorkerFallback{FailureThreshold: 3, Replicas: 2}
+		}},
+		{name: "Missing ScalerConfig", mutate: func(c *v1alpha1.QWorkerScaleConfig) { c.ScalerConfigRef = "missing" }, expectedWarnings: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qworker := &v1alpha1.QWorker{
+				ObjectMeta: metav1.ObjectMeta{Name: "qworker", Namespace: "default"},
+				Spec:       v1alpha1.QWorkerSpec{ScaleConfig: validScaleConfig()},
+			}
+			tt.mutate(&qworker.Spec.ScaleConfig)
+
+			warnings, err := validator.ValidateCreate(context.Background(), qworker)
+			if (err != nil) != tt.expectedError {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if len(warnings) != tt.expectedWarnings {
+				t.Errorf("expected %d warnings, got %v", tt.expectedWarnings, warnings)
+			}
+		})
+	}
+}
+
+func TestQWorkerCustomValidator_ValidateUpdate(t *testing.T) {
+	// a QWorker created before the webhook was enabled, which fails its validation
+	invalid := &v1alpha1.QWorker{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "default"},
+		Spec: v1alpha1.QWorkerSpec{
+			Replicas: ptr.To(3),
+			ScaleConfig: v1alpha1.QWorkerScaleConfig{
+				ScalerConfigRef: "redis",
+				Queue:           "tasks",
+				MinReplicas:     5,
+				MaxReplicas:     2,
+			},
+		},
+	}
+	validator := &QWorkerCustomValidator{}
+	ctx := context.Background()
+
+	cleared := invalid.DeepCopy()
+	cleared.Spec.Replicas = nil
+	if _, err := validator.ValidateUpdate(ctx, invalid, cleared); err != nil {
+		t.Errorf("expected clearing the manual replicas to be allowed, got %v", err)
+	}
+
+	annotated := invalid.DeepCopy()
+	annotated.Annotations = map[string]string{"team": "workers"}
+	if _, err := validator.ValidateUpdate(ctx, invalid, annotated); err != nil {
+		t.Errorf("expected adding an annotation to be allowed, got %v", err)
+	}
+
+	deleted := invalid.DeepCopy()
+	deleted.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	deleted.Spec.ScaleConfig.Queue = "other"
+	if _, err := validator.ValidateUpdate(ctx, invalid, deleted); err != nil {
+		t.Errorf("expected updating a deleted QWorker to be allowed, got %v", err)
+	}
+
+	changed := invalid.DeepCopy()
+	changed.Spec.ScaleConfig.Queue = "other"
+	if _, err := validator.ValidateUpdate(ctx, invalid, changed); err == nil {
+		t.Error("expected a change of the scale config to be validated")
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	"github.com/quickube/QScaler/internal/brokers"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SetupScalerConfigWebhookWithManager registers the validating webhook of ScalerConfig in the manager
+func SetupScalerConfigWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&v1alpha1.ScalerConfig{}).
+		WithValidator(&ScalerConfigCustomValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-quickube-com-v1alpha1-scalerconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=quickube.com,resources=scalerconfigs,verbs=create;update,versions=v1alpha1,name=vscalerconfig-v1alpha1.kb.io,admissionReviewVersions=v1
+
+// ScalerConfigCustomValidator rejects ScalerConfigs of unknown broker types or without the settings their broker needs
+type ScalerConfigCustomValidator struct{}
+
+var _ webhook.CustomValidator = &ScalerConfigCustomValidator{}
+
+func (v *ScalerConfigCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	scalerConfig, ok := obj.(*v1alpha1.ScalerConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a ScalerConfig object but got %T", obj)
+	}
+	return nil, validateScalerConfig(scalerConfig)
+}
+
+// ValidateUpdate only validates changes of the spec, so ScalerConfigs created before the webhook was enabled
+// can still get and lose their finalizers, and be deleted
+func (v *ScalerConfigCustomValidator) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	scalerConfig, ok := newObj.(*v1alpha1.ScalerConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a ScalerConfig object but got %T", newObj)
+	}
+	oldScalerConfig, ok := oldObj.(*v1alpha1.ScalerConfig)
+	if !ok {
+		return nil, fmt.Errorf("expected a ScalerConfig object but got %T", oldObj)
+	}
+	if scalerConfig.DeletionTimestamp != nil || equality.Semantic.DeepEqual(oldScalerConfig.Spec, scalerConfig.Spec) {
+		return nil, nil
+	}
+	return nil, validateScalerConfig(scalerConfig)
+}
+
+func (v *ScalerConfigCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validateScalerConfig(scalerConfig *v1alpha1.ScalerConfig) error {
+	specPath := field.NewPath("spec")
+	allErrs, supported := brokers.ValidateConfig(scalerConfig, specPath.Child("config"))
+	if !supported {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("type"), scalerConfig.Spec.Type, brokers.SupportedTypes()))
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(v1alpha1.GroupVersion.WithKind("ScalerConfig").GroupKind(), scalerConfig.Name, allErrs)
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/quickube/QScaler/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestScalerConfigCustomValidator(t *testing.T) {
+	tests := []struct {
+		name          string
+		spec          v1alpha1.ScalerConfigSpec
+		expectedError bool
+	}{
+		{
+			name: "Valid redis",
+			spec: v1alpha1.ScalerConfigSpec{Type: "redis", Config: v1alpha1.ScalerTypeConfigs{
+				RedisConfig: v1alpha1.RedisConfig{Host: "redis", Port: "6379"},
+			}},
+		},
+		{
+			name:          "Redis without host and port",
+			spec:          v1alpha1.ScalerConfigSpec{Type: "redis"},
+			expectedError: true,
+		},
+		{
+			name: "Redis with an invalid port",
+			spec: v1alpha1.ScalerConfigSpec{Type: "redis", Config: v1alpha1.ScalerTypeConfigs{
+				RedisConfig: v1alpha1.RedisConfig{Host: "redis", Port: "redis"},
+			}},
+			expectedError: true,
+		},
+		{
+			name: "Redis sentinel without host and port",
+			spec: v1alpha1.ScalerConfigSpec{Type: "redis", Config: v1alpha1.ScalerTypeConfigs{
+				RedisConfig: v1alpha1.RedisConfig{Sentinel: &v1alpha1.RedisSentinelConfig{
+					MasterName: "mymaster",
+					Addresses:  []string{"sentinel:26379"},
+				}},
+			}},
+		},
+		{
+			name: "Redis cluster with a database",
+			spec: v1alpha1.ScalerConfigSpec{Type: "redis", Config: v1alpha1.ScalerTypeConfigs{
+				RedisConfig: v1alpha1.RedisConfig{DB: 2, Cluster: &v1alpha1.RedisClusterConfig{Addresses: []string{"redis:6379"}}},
+			}},
+			expectedError: true,
+		},
+		{
+			name:          "Kafka without its config",
+			spec:          v1alpha1.ScalerConfigSpec{Type: "kafka"},
+			expectedError: true,
+		},
+		{
+			name: "Valid SQS",
+			spec: v1alpha1.ScalerConfigSpec{Type: "sqs", Config: v1alpha1.ScalerTypeConfigs{
+				SQSConfig: &v1alpha1.SQSConfig{Region: "us-east-1"},
+			}},
+		},
+		{
+			name:          "Unknown type",
+			spec:          v1alpha1.ScalerConfigSpec{Type: "rediss"},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scalerConfig := &v1alpha1.ScalerConfig{Spec: tt.spec}
+			_, err := (&ScalerConfigCustomValidator{}).ValidateCreate(context.Background(), scalerConfig)
+			if (err != nil) != tt.expectedError {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestScalerConfigCustomValidator_ValidateUpdate(t *testing.T) {
+	// a ScalerConfig created before the webhook was enabled, which fails its validation
+	invalid := &v1alpha1.ScalerConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "default"},
+		Spec:       v1alpha1.ScalerConfigSpec{Type: "redis", Config: v1alpha1.ScalerTypeConfigs{RedisConfig: v1alpha1.RedisConfig{Host: "redis"}}},
+	}
+	validator := &ScalerConfigCustomValidator{}
+	ctx := context.Background()
+
+	withFinalizer := invalid.DeepCopy()
+	withFinalizer.Finalizers = []string{v1alpha1.BrokerFinalizer}
+	if _, err := validator.ValidateUpdate(ctx, invalid, withFinalizer); err != nil {
+		t.Errorf("expected adding a finalizer to be allowed, got %v", err)
+	}
+
+	deleted := withFinalizer.DeepCopy()
+	deleted.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+	deleted.Finalizers = nil
+	if _, err := validator.ValidateUpdate(ctx, withFinalizer, deleted); err != nil {
+		t.Errorf("expected removing the finalizer of a deleted ScalerConfig to be allowed, got %v", err)
+	}
+
+	changed := withFinalizer.DeepCopy()
+	changed.Spec.Config.DB = 1
+	if _, err := validator.ValidateUpdate(ctx, withFinalizer, changed); err == nil {
+		t.Error("expected a change of the spec to be validated")
+	}
+}